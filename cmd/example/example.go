@@ -24,9 +24,14 @@ func main() {
 		[]us.LiquidityProviderPosition{},
 	)
 
-	req.LiquidityProviderTokens = us.FromWalletAddress(req)
+	positions, err := us.FromWalletAddress(req)
+	handleError(err)
+	req.LiquidityProviderTokens = positions
 
-	resp := req.Do()
+	resp, err := req.Do()
+	if err != nil {
+		fmt.Println(err)
+	}
 
 	fmt.Printf("%+v\n", resp)
 
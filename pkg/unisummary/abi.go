@@ -0,0 +1,192 @@
+package unisummary
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+const SELECTOR_BALANCE_OF = "0x70a08231"
+const SELECTOR_TOTAL_SUPPLY = "0x18160ddd"
+const SELECTOR_GET_RESERVES = "0x0902f1ac"
+const SELECTOR_TOKEN0 = "0x0dfe1681"
+const SELECTOR_TOKEN1 = "0xd21220a7"
+const SELECTOR_DECIMALS = "0x313ce567"
+const SELECTOR_SYMBOL = "0x95d89b41"
+const SELECTOR_FACTORY = "0xc45a0155"
+const SELECTOR_PAIR_MINT = "0x6a627842"
+const SELECTOR_PAIR_BURN = "0x89afcb44"
+
+type ContractCaller interface {
+	Call(ctx context.Context, to string, data string) (string, error)
+}
+
+// BlockContractCaller calls contracts as of a past block
+type BlockContractCaller interface {
+	CallAtBlock(ctx context.Context, to string, data string, block uint64) (string, error)
+}
+
+// blockCaller pins a BlockContractCaller to a block
+type blockCaller struct {
+	caller BlockContractCaller
+	block  uint64
+}
+
+func (c blockCaller) Call(ctx context.Context, to string, data string) (string, error) {
+	return c.caller.CallAtBlock(ctx, to, data, c.block)
+}
+
+func callBalanceOf(ctx context.Context, c ContractCaller, tokenAddress string, walletAddress string) (string, error) {
+	return callUint(ctx, c, tokenAddress, encodeCall(SELECTOR_BALANCE_OF, encodeAddress(walletAddress)))
+}
+
+func callTotalSupply(ctx context.Context, c ContractCaller, tokenAddress string) (string, error) {
+	return callUint(ctx, c, tokenAddress, encodeCall(SELECTOR_TOTAL_SUPPLY))
+}
+
+func callGetReserves(ctx context.Context, c ContractCaller, pairAddress string) (string, string, error) {
+	result, err := c.Call(ctx, pairAddress, encodeCall(SELECTOR_GET_RESERVES))
+	if err != nil {
+		return "", "", err
+	}
+	reserve0, err := decodeUint(result, 0)
+	if err != nil {
+		return "", "", err
+	}
+	reserve1, err := decodeUint(result, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return reserve0.String(), reserve1.String(), nil
+}
+
+func callToken(ctx context.Context, c ContractCaller, tokenAddress string) (Token, error) {
+	decimals, err := callUint(ctx, c, tokenAddress, encodeCall(SELECTOR_DECIMALS))
+	if err != nil {
+		return Token{}, err
+	}
+	decimalsInt, err := toInt(decimals)
+	if err != nil {
+		return Token{}, err
+	}
+	result, err := c.Call(ctx, tokenAddress, encodeCall(SELECTOR_SYMBOL))
+	if err != nil {
+		return Token{}, err
+	}
+	symbol, err := decodeString(result)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{symbol, strings.ToLower(tokenAddress), decimalsInt}, nil
+}
+
+func callAddress(ctx context.Context, c ContractCaller, contractAddress string, data string) (string, error) {
+	result, err := c.Call(ctx, contractAddress, data)
+	if err != nil {
+		return "", err
+	}
+	return decodeAddress(result, 0)
+}
+
+func callUint(ctx context.Context, c ContractCaller, contractAddress string, data string) (string, error) {
+	result, err := c.Call(ctx, contractAddress, data)
+	if err != nil {
+		return "", err
+	}
+	value, err := decodeUint(result, 0)
+	if err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+func encodeCall(selector string, args ...string) string {
+	return selector + strings.Join(args, "")
+}
+
+func encodeAddress(address string) string {
+	return leftPad(strings.TrimPrefix(strings.ToLower(address), "0x"))
+}
+
+func encodeUint(value *big.Int) string {
+	return leftPad(value.Text(16))
+}
+
+func leftPad(hex string) string {
+	if len(hex) >= 64 {
+		return hex
+	}
+	return strings.Repeat("0", 64-len(hex)) + hex
+}
+
+func abiWord(result string, index int) (string, error) {
+	data := strings.TrimPrefix(result, "0x")
+	start := index * 64
+	if len(data) < start+64 {
+		return "", malformed("abi result %q has no word %d", result, index)
+	}
+	return data[start : start+64], nil
+}
+
+func decodeUint(result string, index int) (*big.Int, error) {
+	word, err := abiWord(result, index)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := new(big.Int).SetString(word, 16)
+	if !ok {
+		return nil, malformed("invalid abi word %q", word)
+	}
+	return value, nil
+}
+
+// decodeString decodes an ABI string, or a bytes32 as returned by older
+// tokens such as MKR
+func decodeString(result string) (string, error) {
+	data := strings.TrimPrefix(result, "0x")
+	if len(data) == 64 {
+		raw, err := hex.DecodeString(data)
+		if err != nil {
+			return "", malformed("invalid bytes32 %q", result)
+		}
+		return string(bytes.TrimRight(raw, "\x00")), nil
+	}
+	// Offset and length come from untrusted contracts, so they are bounded
+	// by the data before being converted to int
+	size := big.NewInt(int64(len(data) / 2))
+	offset, err := decodeUint(result, 0)
+	if err != nil {
+		return "", err
+	}
+	if offset.Cmp(size) > 0 {
+		return "", malformed("invalid abi string %q", result)
+	}
+	start := int(offset.Int64()) / 32
+	length, err := decodeUint(result, start)
+	if err != nil {
+		return "", err
+	}
+	if length.Cmp(size) > 0 {
+		return "", malformed("invalid abi string %q", result)
+	}
+	begin := (start + 1) * 64
+	end := begin + int(length.Int64())*2
+	if len(data) < end {
+		return "", malformed("invalid abi string %q", result)
+	}
+	raw, err := hex.DecodeString(data[begin:end])
+	if err != nil {
+		return "", malformed("invalid abi string %q", result)
+	}
+	return string(raw), nil
+}
+
+func decodeAddress(result string, index int) (string, error) {
+	word, err := abiWord(result, index)
+	if err != nil {
+		return "", err
+	}
+	return "0x" + word[24:], nil
+}
@@ -0,0 +1,29 @@
+package unisummary
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		name   string
+		result string
+		want   string
+		err    error
+	}{
+		{"abi string", "0x" + leftPad("20") + leftPad("3") + "554e4900000000000000000000000000000000000000000000000000000000", "UNI", nil},
+		{"bytes32", "0x4d4b520000000000000000000000000000000000000000000000000000000000", "MKR", nil},
+		{"length past the data", "0x" + leftPad("20") + leftPad("40") + strings.Repeat("0", 64), "", ErrMalformedResponse},
+		{"overflowing length", "0x" + leftPad("20") + leftPad("4000000000000000") + strings.Repeat("0", 64), "", ErrMalformedResponse},
+		{"overflowing offset", "0x" + leftPad("ffffffffffffffffffff") + strings.Repeat("0", 64), "", ErrMalformedResponse},
+		{"truncated", "0x" + leftPad("20") + "0000", "", ErrMalformedResponse},
+	}
+	for _, test := range tests {
+		got, err := decodeString(test.result)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("%s: decodeString = %q, %v, want %q, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+}
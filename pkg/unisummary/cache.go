@@ -0,0 +1,241 @@
+package unisummary
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedDataSource serves repeated balance, supply, reserve and contract
+// call lookups from memory. Concurrent identical lookups share a single
+// request, and errors are never cached. The cache is created by
+// NewCachedDataSource; without it lookups go straight to the source
+type CachedDataSource struct {
+	Source ChainDataSource
+	// Entries expire after TTL. Zero keeps them as long as the cache, as
+	// the one Do() uses for a single run
+	TTL   time.Duration
+	cache *responseCache
+}
+
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// The counters come first to be 64-bit aligned for atomic access
+type responseCache struct {
+	hits    uint64
+	misses  uint64
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	calls   map[string]*cacheCall
+	// Last removal of the expired entries
+	swept time.Time
+}
+
+type cacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// cacheCall is a lookup in flight, waited on by identical lookups
+type cacheCall struct {
+	done   chan struct{}
+	values []string
+	err    error
+}
+
+func NewCachedDataSource(source ChainDataSource, ttl time.Duration) CachedDataSource {
+	return CachedDataSource{
+		Source: source,
+		TTL:    ttl,
+		cache: &responseCache{
+			entries: map[string]cacheEntry{},
+			calls:   map[string]*cacheCall{},
+		},
+	}
+}
+
+func (c CachedDataSource) Stats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return CacheStats{atomic.LoadUint64(&c.cache.hits), atomic.LoadUint64(&c.cache.misses)}
+}
+
+func (c CachedDataSource) get(ctx context.Context, key string, fetch func() ([]string, error)) ([]string, error) {
+	cache := c.cache
+	if cache == nil {
+		return fetch()
+	}
+	cache.mutex.Lock()
+	if entry, ok := cache.entries[key]; ok {
+		if !entry.expired(time.Now()) {
+			cache.mutex.Unlock()
+			atomic.AddUint64(&cache.hits, 1)
+			return entry.values, nil
+		}
+		delete(cache.entries, key)
+	}
+	if call, ok := cache.calls[key]; ok {
+		cache.mutex.Unlock()
+		atomic.AddUint64(&cache.hits, 1)
+		select {
+		case <-call.done:
+			return call.values, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	cache.calls[key] = call
+	cache.mutex.Unlock()
+	atomic.AddUint64(&cache.misses, 1)
+
+	call.values, call.err = fetch()
+	cache.mutex.Lock()
+	delete(cache.calls, key)
+	if call.err == nil {
+		now := time.Now()
+		entry := cacheEntry{values: call.values}
+		if c.TTL > 0 {
+			entry.expires = now.Add(c.TTL)
+			// Keys such as calls at a block are never looked up again, so
+			// expired entries are swept at most once per TTL
+			if now.Sub(cache.swept) >= c.TTL {
+				cache.sweep(now)
+			}
+		}
+		cache.entries[key] = entry
+	}
+	cache.mutex.Unlock()
+	close(call.done)
+	return call.values, call.err
+}
+
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// sweep removes the expired entries, with the mutex held
+func (cache *responseCache) sweep(now time.Time) {
+	for key, entry := range cache.entries {
+		if entry.expired(now) {
+			delete(cache.entries, key)
+		}
+	}
+	cache.swept = now
+}
+
+func (c CachedDataSource) getString(ctx context.Context, key string, fetch func() (string, error)) (string, error) {
+	values, err := c.get(ctx, key, func() ([]string, error) {
+		value, err := fetch()
+		return []string{value}, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return values[0], nil
+}
+
+func cacheKey(method string, args ...interface{}) string {
+	parts := []string{method}
+	for _, a := range args {
+		parts = append(parts, strings.ToLower(fmt.Sprint(a)))
+	}
+	return strings.Join(parts, "/")
+}
+
+func (c CachedDataSource) GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error) {
+	return c.getString(ctx, cacheKey("balance", tokenAddress, walletAddress), func() (string, error) {
+		return c.Source.GetBalance(ctx, tokenAddress, walletAddress)
+	})
+}
+
+func (c CachedDataSource) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	return c.getString(ctx, cacheKey("supply", tokenAddress), func() (string, error) {
+		return c.Source.GetSupply(ctx, tokenAddress)
+	})
+}
+
+func (c CachedDataSource) Call(ctx context.Context, to string, data string) (string, error) {
+	return c.getString(ctx, cacheKey("call", to, data), func() (string, error) {
+		return forwardCall(ctx, c.Source, to, data)
+	})
+}
+
+func (c CachedDataSource) CallAtBlock(ctx context.Context, to string, data string, block uint64) (string, error) {
+	return c.getString(ctx, cacheKey("callAtBlock", to, data, block), func() (string, error) {
+		return forwardCallAtBlock(ctx, c.Source, to, data, block)
+	})
+}
+
+func (c CachedDataSource) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	values, err := c.get(ctx, cacheKey("reserves", pairAddress), func() ([]string, error) {
+		reserve0, reserve1, err := forwardGetReserves(ctx, c.Source, pairAddress)
+		return []string{reserve0, reserve1}, err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return values[0], values[1], nil
+}
+
+func (c CachedDataSource) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return c.getString(ctx, cacheKey("token0", pairAddress), func() (string, error) {
+		return forwardGetToken0(ctx, c.Source, pairAddress)
+	})
+}
+
+func (c CachedDataSource) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return c.getString(ctx, cacheKey("token1", pairAddress), func() (string, error) {
+		return forwardGetToken1(ctx, c.Source, pairAddress)
+	})
+}
+
+// Logs and wallet histories are fetched once per run, so they are passed
+// through uncached
+
+func (c CachedDataSource) GetLogs(ctx context.Context, query LogQuery) ([]Log, error) {
+	return forwardGetLogs(ctx, c.Source, query)
+}
+
+func (c CachedDataSource) GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error) {
+	return c.Source.GetNormalTransactions(ctx, walletAddress)
+}
+
+func (c CachedDataSource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	return c.Source.GetTokenTransactions(ctx, walletAddress)
+}
+
+func (c CachedDataSource) GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error) {
+	return c.Source.GetInternalTransactions(ctx, walletAddress)
+}
+
+func (c CachedDataSource) GetNormalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanNormalTransactionsResponse, error) {
+	rangeSource, ok := c.Source.(TransactionRangeSource)
+	if !ok {
+		return EtherscanNormalTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetNormalTransactionsFrom(ctx, walletAddress, startBlock)
+}
+
+func (c CachedDataSource) GetTokenTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanTokenTransactionsResponse, error) {
+	rangeSource, ok := c.Source.(TransactionRangeSource)
+	if !ok {
+		return EtherscanTokenTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetTokenTransactionsFrom(ctx, walletAddress, startBlock)
+}
+
+func (c CachedDataSource) GetInternalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanInternalTransactionsResponse, error) {
+	rangeSource, ok := c.Source.(TransactionRangeSource)
+	if !ok {
+		return EtherscanInternalTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetInternalTransactionsFrom(ctx, walletAddress, startBlock)
+}
@@ -0,0 +1,90 @@
+package unisummary
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedDataSourceLiteral(t *testing.T) {
+	server := newJsonRpcStandIn(t, map[string]string{
+		testPair + encodeCall(SELECTOR_TOTAL_SUPPLY): "0x" + leftPad("3e8"),
+	})
+	defer server.Close()
+	cached := CachedDataSource{Source: NewJsonRpcDataSource(server.URL, nil)}
+
+	supply, err := cached.GetSupply(context.Background(), testPair)
+	if err != nil || supply != "1000" {
+		t.Errorf("GetSupply = %q, %v", supply, err)
+	}
+	if stats := cached.Stats(); stats != (CacheStats{}) {
+		t.Errorf("Stats = %+v, want zero", stats)
+	}
+}
+
+func TestPairPriceOracleLiteral(t *testing.T) {
+	server := newJsonRpcStandIn(t, map[string]string{
+		testToken0 + encodeCall(SELECTOR_DECIMALS): "0x" + leftPad("6"),
+		testToken0 + encodeCall(SELECTOR_SYMBOL):   "0x414141" + leftPad("")[6:],
+	})
+	defer server.Close()
+	oracle := PairPriceOracle{Caller: NewJsonRpcDataSource(server.URL, nil)}
+
+	decimals, err := oracle.decimals(context.Background(), testToken0)
+	if err != nil || decimals != 6 {
+		t.Errorf("decimals = %d, %v", decimals, err)
+	}
+}
+
+func TestTransactionStoreLiteral(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unisummary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := &TransactionStore{Path: filepath.Join(dir, "store.json")}
+	stored := StoredDataSource{Source: transactionsOnlySource{}, Store: store}
+
+	if _, err := stored.GetTokenTransactions(context.Background(), testWallet); err != nil {
+		t.Errorf("GetTokenTransactions: %v", err)
+	}
+}
+
+// supplyCounter counts the supply lookups reaching the source
+type supplyCounter struct {
+	transactionsOnlySource
+	calls *int32
+}
+
+func (s supplyCounter) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	atomic.AddInt32(s.calls, 1)
+	return "1", nil
+}
+
+func TestCachedDataSourceExpiry(t *testing.T) {
+	var calls int32
+	cached := NewCachedDataSource(supplyCounter{calls: &calls}, 20*time.Millisecond)
+	ctx := context.Background()
+
+	for _, token := range []string{testToken0, testToken0, testToken1} {
+		cached.GetSupply(ctx, token)
+	}
+	if calls != 2 || len(cached.cache.entries) != 2 {
+		t.Fatalf("%d source calls and %d entries, want 2 and 2", calls, len(cached.cache.entries))
+	}
+	time.Sleep(30 * time.Millisecond)
+	// Storing a new entry sweeps the expired ones, even those never
+	// looked up again
+	cached.GetSupply(ctx, testPair)
+	if len(cached.cache.entries) != 1 {
+		t.Errorf("%d entries after the sweep, want 1", len(cached.cache.entries))
+	}
+	cached.GetSupply(ctx, testPair)
+	if calls != 3 || cached.Stats() != (CacheStats{Hits: 2, Misses: 3}) {
+		t.Errorf("%d source calls, Stats = %+v", calls, cached.Stats())
+	}
+}
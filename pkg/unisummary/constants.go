@@ -2,11 +2,31 @@ package unisummary
 
 const ETHERSCAN_ENDPOINT_SUPPLY = "https://api.etherscan.io/api?module=stats&apikey=%s&action=tokensupply&contractaddress=%s"
 const ETHERSCAN_ENDPOINT_BALANCE = "https://api.etherscan.io/api?module=account&apikey=%s&action=tokenbalance&contractaddress=%s&address=%s&tag=latest"
-const ETHERSCAN_WALLET_ERC20_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=tokentx&address=%s&startblock=0&endblock=999999999&sort=asc"
-const ETHERSCAN_WALLET_NORMAL_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=txlist&address=%s&startblock=0&endblock=99999999&sort=asc"
-const ETHERSCAN_WALLET_INTERNAL_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=txlistinternal&address=%s&startblock=0&endblock=99999999&sort=asc"
+const ETHERSCAN_WALLET_ERC20_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=tokentx&address=%s&startblock=%d&endblock=%d&sort=asc"
+const ETHERSCAN_WALLET_NORMAL_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=txlist&address=%s&startblock=%d&endblock=%d&sort=asc"
+const ETHERSCAN_WALLET_INTERNAL_TRANSACTIONS = "https://api.etherscan.io/api?module=account&apikey=%s&action=txlistinternal&address=%s&startblock=%d&endblock=%d&sort=asc"
+
+// Etherscan returns at most this many rows per request
+const ETHERSCAN_MAX_RESULTS = 10000
+const ETHERSCAN_LATEST_BLOCK = 999999999
+const ETHERSCAN_ENDPOINT_LOGS = "https://api.etherscan.io/api?module=logs&apikey=%s&action=getLogs&fromBlock=%d&toBlock=%d"
+const ETHERSCAN_ENDPOINT_ETH_CALL = "https://api.etherscan.io/api?module=proxy&apikey=%s&action=eth_call&to=%s&data=%s&tag=latest"
+const ETHERSCAN_ENDPOINT_ETH_CALL_AT_BLOCK = "https://api.etherscan.io/api?module=proxy&apikey=%s&action=eth_call&to=%s&data=%s&tag=%s"
 
 var TOKEN_WETH = Token{"WETH", "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", 18}
 
 const UNISWAP_CONTRACT_ADDRESS = "0x7a250d5630b4cf539739df2c5dacb4c659f2488d"
+const UNISWAP_ROUTER01_ADDRESS = "0xf164fc0ec4e93095b804a4795bbe1e041497b92a"
+const UNISWAP_MIGRATOR_ADDRESS = "0x16d4f26c15f3658ec65b1126ff27dd3df2a2996b"
+const UNISWAP_V2_FACTORY_ADDRESS = "0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"
+
+var UNISWAP_V2_CONTRACTS = []string{UNISWAP_CONTRACT_ADDRESS, UNISWAP_ROUTER01_ADDRESS, UNISWAP_MIGRATOR_ADDRESS}
+
+const SUSHISWAP_ROUTER_ADDRESS = "0xd9e1ce17f2641f24ae83637ab66a2cca9c378b9f"
+const SUSHISWAP_FACTORY_ADDRESS = "0xc0aee478e3658e2610c5f7a4a2e1777ce9e4f2ac"
+const SUSHISWAP_LIQUIDITY_PROVIDER_TOKEN_SYMBOL = "SLP"
+
 const LIQUIDITY_PROVIDER_TOKEN_SYMBOL = "UNI-V2"
+
+const UNISWAP_V3_POSITION_MANAGER_ADDRESS = "0xc36442b4a4522e871399cd717abdd847ab11fe88"
+const UNISWAP_V3_FACTORY_ADDRESS = "0x1f98431c8ad98523631ae4a59f267346ea31f984"
@@ -0,0 +1,81 @@
+package unisummary
+
+import (
+	"context"
+	"fmt"
+)
+
+type ChainDataSource interface {
+	GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error)
+	GetSupply(ctx context.Context, tokenAddress string) (string, error)
+	GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error)
+	GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error)
+	GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error)
+}
+
+// PairReader is implemented by data sources able to call Uniswap V2 pair
+// contracts directly. Reserves are returned in token0, token1 order.
+type PairReader interface {
+	GetReserves(ctx context.Context, pairAddress string) (string, string, error)
+	GetToken0(ctx context.Context, pairAddress string) (string, error)
+	GetToken1(ctx context.Context, pairAddress string) (string, error)
+}
+
+// TransactionRangeSource is implemented by data sources able to fetch a
+// wallet history from a block on, for incremental syncs
+type TransactionRangeSource interface {
+	GetNormalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanNormalTransactionsResponse, error)
+	GetTokenTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanTokenTransactionsResponse, error)
+	GetInternalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanInternalTransactionsResponse, error)
+}
+
+// Wrappers around a data source implement every optional interface and
+// forward to the wrapped source, which may return ErrNotSupported
+
+func forwardCall(ctx context.Context, source ChainDataSource, to string, data string) (string, error) {
+	caller, ok := source.(ContractCaller)
+	if !ok {
+		return "", fmt.Errorf("%w: contract calls", ErrNotSupported)
+	}
+	return caller.Call(ctx, to, data)
+}
+
+func forwardCallAtBlock(ctx context.Context, source ChainDataSource, to string, data string, block uint64) (string, error) {
+	caller, ok := source.(BlockContractCaller)
+	if !ok {
+		return "", fmt.Errorf("%w: contract calls at a block", ErrNotSupported)
+	}
+	return caller.CallAtBlock(ctx, to, data, block)
+}
+
+func forwardGetReserves(ctx context.Context, source ChainDataSource, pairAddress string) (string, string, error) {
+	reader, ok := source.(PairReader)
+	if !ok {
+		return "", "", fmt.Errorf("%w: pair reserves", ErrNotSupported)
+	}
+	return reader.GetReserves(ctx, pairAddress)
+}
+
+func forwardGetToken0(ctx context.Context, source ChainDataSource, pairAddress string) (string, error) {
+	reader, ok := source.(PairReader)
+	if !ok {
+		return "", fmt.Errorf("%w: pair tokens", ErrNotSupported)
+	}
+	return reader.GetToken0(ctx, pairAddress)
+}
+
+func forwardGetToken1(ctx context.Context, source ChainDataSource, pairAddress string) (string, error) {
+	reader, ok := source.(PairReader)
+	if !ok {
+		return "", fmt.Errorf("%w: pair tokens", ErrNotSupported)
+	}
+	return reader.GetToken1(ctx, pairAddress)
+}
+
+func forwardGetLogs(ctx context.Context, source ChainDataSource, query LogQuery) ([]Log, error) {
+	logSource, ok := source.(LogSource)
+	if !ok {
+		return nil, fmt.Errorf("%w: event logs", ErrNotSupported)
+	}
+	return logSource.GetLogs(ctx, query)
+}
@@ -0,0 +1,93 @@
+package unisummary
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+var ErrInvalidApiKey = errors.New("invalid api key")
+var ErrMalformedResponse = errors.New("malformed response")
+var ErrUnexpectedTransfer = errors.New("unexpected transfer")
+var ErrRequestFailed = errors.New("request failed")
+var ErrNotSupported = errors.New("not supported by data source")
+
+type EtherscanError struct {
+	Message string
+	Result  string
+	Err     error
+}
+
+func (e *EtherscanError) Error() string {
+	return fmt.Sprintf("etherscan: %s: %s (%s)", e.Err, e.Message, e.Result)
+}
+
+func (e *EtherscanError) Unwrap() error {
+	return e.Err
+}
+
+func newEtherscanError(message, result string) *EtherscanError {
+	err := ErrRequestFailed
+	lower := strings.ToLower(result)
+	if strings.Contains(lower, "rate limit") {
+		err = ErrRateLimited
+	} else if strings.Contains(lower, "invalid api key") || strings.Contains(lower, "missing/invalid api key") {
+		err = ErrInvalidApiKey
+	}
+	return &EtherscanError{Message: message, Result: result, Err: err}
+}
+
+type PositionError struct {
+	Position LiquidityProviderPosition
+	Err      error
+}
+
+func (e PositionError) Error() string {
+	return fmt.Sprintf("position %s: %s", e.Position.Pair.Id, e.Err)
+}
+
+func (e PositionError) Unwrap() error {
+	return e.Err
+}
+
+// PositionErrors is returned by Do() when some positions could not be
+// summarized. Responses for the remaining positions are still returned.
+type PositionErrors []PositionError
+
+func (es PositionErrors) Error() string {
+	messages := []string{}
+	for _, e := range es {
+		messages = append(messages, e.Error())
+	}
+	return fmt.Sprintf("%d position(s) failed: %s", len(es), strings.Join(messages, "; "))
+}
+
+type V3PositionError struct {
+	Position V3Position
+	Err      error
+}
+
+func (e V3PositionError) Error() string {
+	return fmt.Sprintf("position UNI-V3 #%s: %s", e.Position.TokenId, e.Err)
+}
+
+func (e V3PositionError) Unwrap() error {
+	return e.Err
+}
+
+// V3PositionErrors is returned by DoV3() when some positions could not be
+// summarized, along with the responses for the remaining ones
+type V3PositionErrors []V3PositionError
+
+func (es V3PositionErrors) Error() string {
+	messages := []string{}
+	for _, e := range es {
+		messages = append(messages, e.Error())
+	}
+	return fmt.Sprintf("%d position(s) failed: %s", len(es), strings.Join(messages, "; "))
+}
+
+func malformed(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformedResponse, fmt.Sprintf(format, a...))
+}
@@ -1,31 +1,244 @@
 package unisummary
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"math"
+	"net/http"
 	"time"
 )
 
-func getBalance(us UniswapSummaryRequest, tokenAddress string, walletAddress string) string {
-	endpoint := fmt.Sprintf(us.EtherscanBalanceEndpoint, us.EtherscanApiKey, tokenAddress, walletAddress)
-	result := getResult(endpoint)
-	return result
+type EtherscanDataSource struct {
+	ApiKey                       string
+	SupplyEndpoint               string
+	BalanceEndpoint              string
+	NormalTransactionsEndpoint   string
+	TokenTransactionsEndpoint    string
+	InternalTransactionsEndpoint string
+	CallEndpoint                 string
+	CallAtBlockEndpoint          string
+	LogsEndpoint                 string
+	// Shared by the data sources using the same API key. Nil disables it
+	RateLimiter *RateLimiter
+	MaxAttempts int
+	RetryDelay  time.Duration
 }
 
-func getSupply(us UniswapSummaryRequest, tokenAddress string) string {
-	endpoint := fmt.Sprintf(us.EtherscanSupplyEndpoint, us.EtherscanApiKey, tokenAddress)
-	result := getResult(endpoint)
-	return result
+func NewEtherscanDataSource(key string) *EtherscanDataSource {
+	return &EtherscanDataSource{
+		ApiKey:                       key,
+		SupplyEndpoint:               ETHERSCAN_ENDPOINT_SUPPLY,
+		BalanceEndpoint:              ETHERSCAN_ENDPOINT_BALANCE,
+		NormalTransactionsEndpoint:   ETHERSCAN_WALLET_NORMAL_TRANSACTIONS,
+		TokenTransactionsEndpoint:    ETHERSCAN_WALLET_ERC20_TRANSACTIONS,
+		InternalTransactionsEndpoint: ETHERSCAN_WALLET_INTERNAL_TRANSACTIONS,
+		CallEndpoint:                 ETHERSCAN_ENDPOINT_ETH_CALL,
+		CallAtBlockEndpoint:          ETHERSCAN_ENDPOINT_ETH_CALL_AT_BLOCK,
+		LogsEndpoint:                 ETHERSCAN_ENDPOINT_LOGS,
+		RateLimiter:                  EtherscanRateLimiter(key),
+		MaxAttempts:                  RETRY_MAX_ATTEMPTS,
+		RetryDelay:                   RETRY_BASE_DELAY,
+	}
+}
+
+func (es EtherscanDataSource) GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error) {
+	endpoint := fmt.Sprintf(es.BalanceEndpoint, es.ApiKey, tokenAddress, walletAddress)
+	return es.getResult(ctx, endpoint)
+}
+
+func (es EtherscanDataSource) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	endpoint := fmt.Sprintf(es.SupplyEndpoint, es.ApiKey, tokenAddress)
+	return es.getResult(ctx, endpoint)
+}
+
+func (es EtherscanDataSource) Call(ctx context.Context, to string, data string) (string, error) {
+	endpoint := fmt.Sprintf(es.CallEndpoint, es.ApiKey, to, data)
+	return es.getResult(ctx, endpoint)
+}
+
+func (es EtherscanDataSource) CallAtBlock(ctx context.Context, to string, data string, block uint64) (string, error) {
+	endpoint := fmt.Sprintf(es.CallAtBlockEndpoint, es.ApiKey, to, data, toHex(block))
+	return es.getResult(ctx, endpoint)
+}
+
+func (es EtherscanDataSource) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	return callGetReserves(ctx, es, pairAddress)
+}
+
+func (es EtherscanDataSource) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, es, pairAddress, encodeCall(SELECTOR_TOKEN0))
+}
+
+func (es EtherscanDataSource) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, es, pairAddress, encodeCall(SELECTOR_TOKEN1))
+}
+
+func (es EtherscanDataSource) GetLogs(ctx context.Context, query LogQuery) ([]Log, error) {
+	endpoint := fmt.Sprintf(es.LogsEndpoint, es.ApiKey, query.FromBlock, query.ToBlock)
+	if query.Address != "" {
+		endpoint += "&address=" + query.Address
+	}
+	for i, topic := range query.Topics {
+		if topic == "" {
+			continue
+		}
+		endpoint += fmt.Sprintf("&topic%d=%s", i, topic)
+		for j := 0; j < i; j++ {
+			if query.Topics[j] != "" {
+				endpoint += fmt.Sprintf("&topic%d_%d_opr=and", j, i)
+			}
+		}
+	}
+	var response EtherscanLogsResponse
+	err := es.getJson(ctx, endpoint, &response)
+	if err != nil {
+		return nil, err
+	}
+	logs := []Log{}
+	for _, l := range response.Result {
+		blockNumber, err := parseHexUint64(l.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		timeStamp, err := parseHexUint64(l.TimeStamp)
+		if err != nil {
+			return nil, err
+		}
+		logIndex, err := parseHexUint64(l.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, Log{
+			Address:         l.Address,
+			Topics:          l.Topics,
+			Data:            l.Data,
+			BlockNumber:     blockNumber,
+			TimeStamp:       time.Unix(int64(timeStamp), 0),
+			TransactionHash: l.TransactionHash,
+			LogIndex:        logIndex,
+		})
+	}
+	return logs, nil
 }
 
-func getResult(endpoint string) string {
-	responseBody := callEndpoint(endpoint)
+func (es EtherscanDataSource) GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error) {
+	return es.GetInternalTransactionsFrom(ctx, walletAddress, 0)
+}
+
+func (es EtherscanDataSource) GetInternalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanInternalTransactionsResponse, error) {
+	var response EtherscanInternalTransactionsResponse
+	err := walkBlockRanges(startBlock, func(startBlock uint64) ([]string, error) {
+		endpoint := fmt.Sprintf(es.InternalTransactionsEndpoint, es.ApiKey, walletAddress, startBlock, ETHERSCAN_LATEST_BLOCK)
+		var page EtherscanInternalTransactionsResponse
+		err := es.getJson(ctx, endpoint, &page)
+		response.Status, response.Message = page.Status, page.Message
+		response.Result = append(response.Result, page.Result...)
+		blocks := []string{}
+		for _, t := range page.Result {
+			blocks = append(blocks, t.BlockNumber)
+		}
+		return blocks, err
+	}, func(rows int) {
+		response.Result = response.Result[:rows]
+	})
+	return response, err
+}
+
+func (es EtherscanDataSource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	return es.GetTokenTransactionsFrom(ctx, walletAddress, 0)
+}
+
+func (es EtherscanDataSource) GetTokenTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanTokenTransactionsResponse, error) {
+	var response EtherscanTokenTransactionsResponse
+	err := walkBlockRanges(startBlock, func(startBlock uint64) ([]string, error) {
+		endpoint := fmt.Sprintf(es.TokenTransactionsEndpoint, es.ApiKey, walletAddress, startBlock, ETHERSCAN_LATEST_BLOCK)
+		var page EtherscanTokenTransactionsResponse
+		err := es.getJson(ctx, endpoint, &page)
+		response.Status, response.Message = page.Status, page.Message
+		response.Result = append(response.Result, page.Result...)
+		blocks := []string{}
+		for _, t := range page.Result {
+			blocks = append(blocks, t.BlockNumber)
+		}
+		return blocks, err
+	}, func(rows int) {
+		response.Result = response.Result[:rows]
+	})
+	return response, err
+}
+
+func (es EtherscanDataSource) GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error) {
+	return es.GetNormalTransactionsFrom(ctx, walletAddress, 0)
+}
+
+func (es EtherscanDataSource) GetNormalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanNormalTransactionsResponse, error) {
+	var response EtherscanNormalTransactionsResponse
+	err := walkBlockRanges(startBlock, func(startBlock uint64) ([]string, error) {
+		endpoint := fmt.Sprintf(es.NormalTransactionsEndpoint, es.ApiKey, walletAddress, startBlock, ETHERSCAN_LATEST_BLOCK)
+		var page EtherscanNormalTransactionsResponse
+		err := es.getJson(ctx, endpoint, &page)
+		response.Status, response.Message = page.Status, page.Message
+		response.Result = append(response.Result, page.Result...)
+		blocks := []string{}
+		for _, t := range page.Result {
+			blocks = append(blocks, t.BlockNumber)
+		}
+		return blocks, err
+	}, func(rows int) {
+		response.Result = response.Result[:rows]
+	})
+	return response, err
+}
+
+// walkBlockRanges requests a wallet history in block ranges, as Etherscan
+// caps each response at ETHERSCAN_MAX_RESULTS rows. fetch appends the rows
+// from a start block and returns their block numbers. A full page may end
+// midway through its last block, so the rows of that block are dropped
+// with truncate and requested again as the start of the next range
+func walkBlockRanges(startBlock uint64, fetch func(startBlock uint64) ([]string, error), truncate func(rows int)) error {
+	rows := 0
+	for {
+		blocks, err := fetch(startBlock)
+		if err != nil {
+			return err
+		}
+		rows += len(blocks)
+		if len(blocks) < ETHERSCAN_MAX_RESULTS {
+			return nil
+		}
+		lastBlock, err := toInt(blocks[len(blocks)-1])
+		if err != nil {
+			return err
+		}
+		if uint64(lastBlock) == startBlock {
+			return malformed("more than %d rows in block %d", ETHERSCAN_MAX_RESULTS, startBlock)
+		}
+		for i := len(blocks) - 1; i >= 0 && blocks[i] == blocks[len(blocks)-1]; i-- {
+			rows--
+		}
+		truncate(rows)
+		startBlock = uint64(lastBlock)
+	}
+}
+
+func (es EtherscanDataSource) getJson(ctx context.Context, endpoint string, v interface{}) error {
+	responseBody, err := es.callEndpoint(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(responseBody), v)
+	if err != nil {
+		return malformed("%s", err)
+	}
+	return nil
+}
+
+func (es EtherscanDataSource) getResult(ctx context.Context, endpoint string) (string, error) {
 	var stringResult StringResult
-	err := json.Unmarshal([]byte(responseBody), &stringResult)
-	handleError(err)
-	return stringResult.Result
+	err := es.getJson(ctx, endpoint, &stringResult)
+	return stringResult.Result, err
 }
 
 type StringResult struct {
@@ -34,60 +247,82 @@ type StringResult struct {
 	Result  string `json:"result"`
 }
 
-func callEndpoint(endpoint string) string {
+// Etherscan reports empty lists with status 0 and one of these messages
+var ETHERSCAN_EMPTY_RESULT_MESSAGES = []string{"No transactions found", "No records found"}
+
+// callEndpoint waits for the rate limiter before every request. Failed
+// requests are retried with a jittered backoff, except when Etherscan
+// reports its rate limit was reached, which pauses every request made
+// with the key
+func (es EtherscanDataSource) callEndpoint(ctx context.Context, endpoint string) (string, error) {
+	maxAttempts := es.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = RETRY_MAX_ATTEMPTS
+	}
 	attempts := 0
-	var body string
 	for {
-		throttleRequest(attempts)
-		log(fmt.Sprintf("Fetching endpoint %s...", endpoint))
-		resp, err := client.Get(endpoint)
-		handleError(err)
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		body = string(bodyBytes)
-		handleError(err)
-		var data map[string]interface{}
-		err = json.Unmarshal(bodyBytes, &data)
-		handleError(err)
-		if status, ok := data["status"].(string); ok && status != "1" {
-			if shouldRetry(attempts) {
-				attempts++
-				continue
+		if es.RateLimiter != nil {
+			if err := es.RateLimiter.Wait(ctx); err != nil {
+				return "", err
 			}
-			panic(fmt.Sprintf("Status for endpoint %s should be 1", endpoint))
 		}
-		if _, ok := data["result"]; !ok {
-			if shouldRetry(attempts) {
-				attempts++
-				continue
-			}
-			panic(fmt.Sprintf("Expecting property `result` for endpoint %s", endpoint))
+		body, err := fetchEndpoint(ctx, endpoint)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
 		}
-		break
+		var rpcErr *JsonRpcError
+		if errors.Is(err, ErrInvalidApiKey) || errors.As(err, &rpcErr) || attempts >= maxAttempts {
+			return "", err
+		}
+		if errors.Is(err, ErrRateLimited) && es.RateLimiter != nil {
+			es.RateLimiter.Pause(RATE_LIMIT_PAUSE)
+		} else if err := sleep(ctx, retryDelay(es.RetryDelay, attempts)); err != nil {
+			return "", err
+		}
+		attempts++
 	}
-	return body
 }
 
-var LAST_FAILURE_TIME = int64(0)
-var THROTTLE_DURATION = 250 * time.Millisecond
-var MAX_ATTEMPTS = 5
-
-func throttleRequest(attempts int) {
-	ellapsed := time.Now().UnixNano() - LAST_FAILURE_TIME
-	left := THROTTLE_DURATION - time.Duration(ellapsed)
-	if left < 0 {
-		return
+func fetchEndpoint(ctx context.Context, endpoint string) (string, error) {
+	log(fmt.Sprintf("Fetching endpoint %s...", endpoint))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRequestFailed, err)
 	}
-	wait := float64(left) * math.Pow(2.0, float64(attempts))
-	log(fmt.Sprintf("Sleeping for %0.2f milliseconds ", wait/1e6))
-	// Exponential backoff
-	time.Sleep(time.Duration(wait) * time.Nanosecond)
-	log("Finished sleeping...")
-}
-
-func shouldRetry(attempts int) bool {
-	LAST_FAILURE_TIME = time.Now().UnixNano()
-	if attempts < MAX_ATTEMPTS {
-		return true
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(bodyBytes, &data)
+	if err != nil {
+		return "", malformed("%s", err)
+	}
+	if status, ok := data["status"].(string); ok && status != "1" {
+		message, _ := data["message"].(string)
+		for _, empty := range ETHERSCAN_EMPTY_RESULT_MESSAGES {
+			if message == empty {
+				return string(bodyBytes), nil
+			}
+		}
+		result, _ := data["result"].(string)
+		return "", newEtherscanError(message, result)
+	}
+	if rpcErr, ok := data["error"].(map[string]interface{}); ok {
+		code, _ := rpcErr["code"].(float64)
+		message, _ := rpcErr["message"].(string)
+		return "", &JsonRpcError{Code: int(code), Message: message}
+	}
+	if _, ok := data["result"]; !ok {
+		return "", malformed("expecting property `result`")
 	}
-	return false
+	return string(bodyBytes), nil
 }
@@ -0,0 +1,62 @@
+package unisummary
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// blockRows returns count rows of each block, in block order
+func blockRows(counts map[int]int, blocks ...int) []string {
+	rows := []string{}
+	for _, b := range blocks {
+		for i := 0; i < counts[b]; i++ {
+			rows = append(rows, strconv.Itoa(b))
+		}
+	}
+	return rows
+}
+
+func TestWalkBlockRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   []string
+		starts []uint64
+		err    error
+	}{
+		{"single page", blockRows(map[int]int{1: 3, 2: 2}, 1, 2), []uint64{0}, nil},
+		{"page ending at a block boundary", blockRows(map[int]int{1: ETHERSCAN_MAX_RESULTS - 5, 2: 5, 3: 2}, 1, 2, 3), []uint64{0, 2}, nil},
+		{"page ending midway through a block", blockRows(map[int]int{1: ETHERSCAN_MAX_RESULTS - 1, 2: 3, 3: 5}, 1, 2, 3), []uint64{0, 2}, nil},
+		{"last block repeated across the page end", blockRows(map[int]int{1: ETHERSCAN_MAX_RESULTS - 4, 2: 9, 3: 1}, 1, 2, 3), []uint64{0, 2}, nil},
+		{"more rows in a block than a page", blockRows(map[int]int{1: 1, 2: ETHERSCAN_MAX_RESULTS + 1}, 1, 2), []uint64{0, 2}, ErrMalformedResponse},
+	}
+	for _, test := range tests {
+		var got []string
+		var starts []uint64
+		err := walkBlockRanges(0, func(startBlock uint64) ([]string, error) {
+			starts = append(starts, startBlock)
+			page := []string{}
+			for _, row := range test.rows {
+				block, _ := strconv.Atoi(row)
+				if uint64(block) >= startBlock && len(page) < ETHERSCAN_MAX_RESULTS {
+					page = append(page, row)
+				}
+			}
+			got = append(got, page...)
+			return page, nil
+		}, func(rows int) {
+			got = got[:rows]
+		})
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(starts, test.starts) {
+			t.Errorf("%s: requested from blocks %v, want %v", test.name, starts, test.starts)
+		}
+		if test.err == nil && !reflect.DeepEqual(got, test.rows) {
+			t.Errorf("%s: got %d rows, want %d without gaps or repeats", test.name, len(got), len(test.rows))
+		}
+	}
+}
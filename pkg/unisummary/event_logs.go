@@ -0,0 +1,172 @@
+package unisummary
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TOPIC_TRANSFER = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+const TOPIC_MINT = "0x4c209b5fc8ad50758f13e2e1088ba56a560dff690a1c6fef26394f4c03821c4f"
+const TOPIC_BURN = "0xdccd412f0b1252819cb1fd330b93224ca42612892bb3f4f789976e6d81936496"
+const TOPIC_SWAP = "0xd78ad95fa46c994b6551d0da85fc275fe613ce37657fb8d5e3d130840159d822"
+const TOPIC_SYNC = "0x1c411e9a96e071241c2f21f7726b17ae89e3cab4c78be50e062b03a9fffbbad1"
+
+const ZERO_ADDRESS = "0x0000000000000000000000000000000000000000"
+
+type Log struct {
+	Address         string
+	Topics          []string
+	Data            string
+	BlockNumber     uint64
+	TimeStamp       time.Time
+	TransactionHash string
+	LogIndex        uint64
+}
+
+// LogQuery selects logs of a block range. Empty topics match anything
+type LogQuery struct {
+	Address   string
+	FromBlock uint64
+	ToBlock   uint64
+	Topics    []string
+}
+
+// LogSource is implemented by data sources able to fetch event logs, such
+// as Etherscan's getLogs or a node's eth_getLogs
+type LogSource interface {
+	GetLogs(ctx context.Context, query LogQuery) ([]Log, error)
+}
+
+type TransferEvent struct {
+	Token string
+	From  string
+	To    string
+	Value *big.Int
+}
+
+type MintEvent struct {
+	Pair    string
+	Sender  string
+	Amount0 *big.Int
+	Amount1 *big.Int
+}
+
+type BurnEvent struct {
+	Pair    string
+	Sender  string
+	To      string
+	Amount0 *big.Int
+	Amount1 *big.Int
+}
+
+type SwapEvent struct {
+	Pair       string
+	Sender     string
+	To         string
+	Amount0In  *big.Int
+	Amount1In  *big.Int
+	Amount0Out *big.Int
+	Amount1Out *big.Int
+}
+
+type SyncEvent struct {
+	Pair     string
+	Reserve0 *big.Int
+	Reserve1 *big.Int
+}
+
+// DecodeLog decodes Uniswap V2 pair and ERC-20 events into one of
+// TransferEvent, MintEvent, BurnEvent, SwapEvent or SyncEvent. Logs with
+// other topics decode to nil
+func DecodeLog(l Log) (interface{}, error) {
+	if len(l.Topics) == 0 {
+		return nil, nil
+	}
+	address := strings.ToLower(l.Address)
+	switch strings.ToLower(l.Topics[0]) {
+	case TOPIC_TRANSFER:
+		// ERC-721 transfers share the topic but index the token id
+		if len(l.Topics) != 3 {
+			return nil, nil
+		}
+		values, err := decodeWords(l.Data, 1)
+		if err != nil {
+			return nil, err
+		}
+		return TransferEvent{address, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), values[0]}, nil
+	case TOPIC_MINT:
+		if len(l.Topics) != 2 {
+			return nil, malformed("mint log %s has %d topics", l.TransactionHash, len(l.Topics))
+		}
+		values, err := decodeWords(l.Data, 2)
+		if err != nil {
+			return nil, err
+		}
+		return MintEvent{address, topicAddress(l.Topics[1]), values[0], values[1]}, nil
+	case TOPIC_BURN:
+		if len(l.Topics) != 3 {
+			return nil, malformed("burn log %s has %d topics", l.TransactionHash, len(l.Topics))
+		}
+		values, err := decodeWords(l.Data, 2)
+		if err != nil {
+			return nil, err
+		}
+		return BurnEvent{address, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), values[0], values[1]}, nil
+	case TOPIC_SWAP:
+		if len(l.Topics) != 3 {
+			return nil, malformed("swap log %s has %d topics", l.TransactionHash, len(l.Topics))
+		}
+		values, err := decodeWords(l.Data, 4)
+		if err != nil {
+			return nil, err
+		}
+		return SwapEvent{address, topicAddress(l.Topics[1]), topicAddress(l.Topics[2]), values[0], values[1], values[2], values[3]}, nil
+	case TOPIC_SYNC:
+		values, err := decodeWords(l.Data, 2)
+		if err != nil {
+			return nil, err
+		}
+		return SyncEvent{address, values[0], values[1]}, nil
+	}
+	return nil, nil
+}
+
+func decodeWords(data string, count int) ([]*big.Int, error) {
+	values := []*big.Int{}
+	for i := 0; i < count; i++ {
+		value, err := decodeUint(data, i)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func topicAddress(topic string) string {
+	topic = strings.ToLower(strings.TrimPrefix(topic, "0x"))
+	if len(topic) < 40 {
+		return topic
+	}
+	return "0x" + topic[len(topic)-40:]
+}
+
+// Etherscan encodes zero as "0x" in log fields
+func parseHexUint64(str string) (uint64, error) {
+	hex := strings.TrimPrefix(str, "0x")
+	if hex == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		return 0, malformed("invalid hex number %q", str)
+	}
+	return value, nil
+}
+
+func toHex(value uint64) string {
+	return "0x" + strconv.FormatUint(value, 16)
+}
@@ -0,0 +1,292 @@
+package unisummary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lpMovement is the net change of the user LP balance of one pair within
+// one transaction
+type lpMovement struct {
+	Hash        string
+	BlockNumber uint64
+	Date        time.Time
+	Pair        Token
+	Delta       *big.Int
+}
+
+type eventLogReader struct {
+	logSource  LogSource
+	pairReader PairReader
+	tokens     map[string]Token
+	pairTokens map[string][2]Token
+	factories  map[string]string
+}
+
+// liquidityEventsFromLogs derives liquidity events from the Mint and Burn
+// logs of the pairs whose LP tokens the user received or sent, instead of
+// guessing them from the token transfers of each transaction
+func liquidityEventsFromLogs(ctx context.Context, us *UniswapSummaryRequest, logSource LogSource, pairReader PairReader, normal EtherscanNormalTransactionsResponse, tokenTransactions EtherscanTokenTransactionsResponse) ([]LiquidityEvent, error) {
+	reader := eventLogReader{
+		logSource:  logSource,
+		pairReader: pairReader,
+		tokens:     map[string]Token{strings.ToLower(TOKEN_WETH.Address): TOKEN_WETH},
+		pairTokens: map[string][2]Token{},
+		factories:  map[string]string{},
+	}
+	for _, tt := range tokenTransactions.Result {
+		decimals, err := toInt(tt.TokenDecimal)
+		if err != nil {
+			return nil, err
+		}
+		reader.tokens[strings.ToLower(tt.ContractAddress)] = Token{tt.TokenSymbol, strings.ToLower(tt.ContractAddress), decimals}
+	}
+
+	gasCosts := map[string]TokenAmount{}
+	for _, t := range normal.Result {
+		gasUsed, err := toBigInt(t.GasUsed)
+		if err != nil {
+			return nil, err
+		}
+		gasPrice, err := toBigInt(t.GasPrice)
+		if err != nil {
+			return nil, err
+		}
+		gasCosts[t.Hash] = Transaction{GasUsed: gasUsed, GasPrice: gasPrice}.GasCost()
+	}
+
+	movements, err := lpMovements(us, tokenTransactions)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []LiquidityEvent{}
+	for _, m := range movements {
+		e, ok, err := reader.liquidityEvent(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		protocol, err := reader.getProtocol(ctx, us, m.Pair)
+		if err != nil {
+			return nil, err
+		}
+		e.Protocol = protocol.Name
+		if gasCost, ok := gasCosts[m.Hash]; ok {
+			e.GasCost = gasCost
+		} else {
+			e.GasCost = NewTokenAmount(new(big.Int), TOKEN_WETH.Decimals)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func lpMovements(us *UniswapSummaryRequest, tokenTransactions EtherscanTokenTransactionsResponse) ([]lpMovement, error) {
+	movements := []lpMovement{}
+	for _, tt := range tokenTransactions.Result {
+		if !us.isLiquidityProviderToken(tt.TokenSymbol) || us.isInternalTransfer(tt.From, tt.To) {
+			continue
+		}
+		value, err := toBigInt(tt.Value)
+		if err != nil {
+			return nil, err
+		}
+		if us.isOwnAddress(tt.From) {
+			value.Neg(value)
+		} else if !us.isOwnAddress(tt.To) {
+			return nil, fmt.Errorf("%w: neither %s nor %s is the user wallet address in transaction %s", ErrUnexpectedTransfer, tt.From, tt.To, tt.Hash)
+		}
+		index := -1
+		for i, m := range movements {
+			if m.Hash == tt.Hash && icaseCompare(m.Pair.Address, tt.ContractAddress) {
+				index = i
+				break
+			}
+		}
+		if index >= 0 {
+			movements[index].Delta.Add(movements[index].Delta, value)
+			continue
+		}
+		blockNumber, err := toInt(tt.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		date, err := toTime(tt.TimeStamp)
+		if err != nil {
+			return nil, err
+		}
+		decimals, err := toInt(tt.TokenDecimal)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, lpMovement{
+			Hash:        tt.Hash,
+			BlockNumber: uint64(blockNumber),
+			Date:        date,
+			Pair:        Token{tt.TokenSymbol, strings.ToLower(tt.ContractAddress), decimals},
+			Delta:       value,
+		})
+	}
+	return movements, nil
+}
+
+// liquidityEvent matches a LP balance change with the Mint or Burn of the
+// pair in the same transaction. Movements without one (plain transfers)
+// are not liquidity events
+func (r eventLogReader) liquidityEvent(ctx context.Context, m lpMovement) (LiquidityEvent, bool, error) {
+	if m.Delta.Sign() == 0 {
+		return LiquidityEvent{}, false, nil
+	}
+	logs, err := r.logSource.GetLogs(ctx, LogQuery{
+		Address:   m.Pair.Address,
+		FromBlock: m.BlockNumber,
+		ToBlock:   m.BlockNumber,
+	})
+	if err != nil {
+		return LiquidityEvent{}, false, err
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].LogIndex < logs[j].LogIndex })
+
+	// The pair mints (or burns) the liquidity right before emitting Mint
+	// (or Burn). Earlier mints in the same call are protocol fees
+	var lastMinted, lastBurned *big.Int
+	liquidity := new(big.Int)
+	amount0 := new(big.Int)
+	amount1 := new(big.Int)
+	for _, l := range logs {
+		if !strings.EqualFold(l.TransactionHash, m.Hash) || !icaseCompare(l.Address, m.Pair.Address) {
+			continue
+		}
+		decoded, err := DecodeLog(l)
+		if err != nil {
+			return LiquidityEvent{}, false, err
+		}
+		switch d := decoded.(type) {
+		case TransferEvent:
+			if d.From == ZERO_ADDRESS {
+				lastMinted = d.Value
+			} else if d.To == ZERO_ADDRESS {
+				lastBurned = d.Value
+			}
+		case MintEvent:
+			if m.Delta.Sign() > 0 && lastMinted != nil {
+				liquidity.Add(liquidity, lastMinted)
+				amount0.Add(amount0, d.Amount0)
+				amount1.Add(amount1, d.Amount1)
+			}
+			lastMinted = nil
+		case BurnEvent:
+			if m.Delta.Sign() < 0 && lastBurned != nil {
+				liquidity.Add(liquidity, lastBurned)
+				amount0.Add(amount0, d.Amount0)
+				amount1.Add(amount1, d.Amount1)
+			}
+			lastBurned = nil
+		}
+	}
+	if liquidity.Sign() == 0 {
+		return LiquidityEvent{}, false, nil
+	}
+
+	tokens, err := r.getPairTokens(ctx, m.Pair.Address)
+	if err != nil {
+		return LiquidityEvent{}, false, err
+	}
+
+	pairQuantity := new(big.Int).Abs(m.Delta)
+	share := new(big.Rat).SetFrac(pairQuantity, liquidity)
+	if share.Cmp(big.NewRat(1, 1)) > 0 {
+		share = big.NewRat(1, 1)
+	}
+	eventType := AddLiquidity
+	if m.Delta.Sign() < 0 {
+		eventType = RemoveLiquidity
+	}
+	return LiquidityEvent{
+		Type:  eventType,
+		Hash:  m.Hash,
+		Block: m.BlockNumber,
+		Date:  m.Date,
+		Pair: Token{
+			Id:       m.Pair.Id + " " + tokens[0].Id + " " + tokens[1].Id,
+			Address:  m.Pair.Address,
+			Decimals: m.Pair.Decimals,
+		},
+		Token1:         tokens[0],
+		Token2:         tokens[1],
+		PairQuantity:   NewTokenAmount(pairQuantity, m.Pair.Decimals),
+		Token1Quantity: scaleAmount(NewTokenAmount(amount0, tokens[0].Decimals), share),
+		Token2Quantity: scaleAmount(NewTokenAmount(amount1, tokens[1].Decimals), share),
+	}, true, nil
+}
+
+func (r eventLogReader) getPairTokens(ctx context.Context, pairAddress string) ([2]Token, error) {
+	if tokens, ok := r.pairTokens[pairAddress]; ok {
+		return tokens, nil
+	}
+	token0, err := r.pairReader.GetToken0(ctx, pairAddress)
+	if err != nil {
+		return [2]Token{}, err
+	}
+	token1, err := r.pairReader.GetToken1(ctx, pairAddress)
+	if err != nil {
+		return [2]Token{}, err
+	}
+	tokens := [2]Token{}
+	for i, address := range []string{token0, token1} {
+		tokens[i], err = r.getToken(ctx, address)
+		if err != nil {
+			return [2]Token{}, err
+		}
+	}
+	r.pairTokens[pairAddress] = tokens
+	return tokens, nil
+}
+
+// getProtocol identifies the DEX of a pair by its factory, falling back to
+// the LP token symbol when the factory cannot be read
+func (r eventLogReader) getProtocol(ctx context.Context, us *UniswapSummaryRequest, pair Token) (Protocol, error) {
+	factory, ok := r.factories[pair.Address]
+	if !ok {
+		if caller, isCaller := r.pairReader.(ContractCaller); isCaller {
+			var err error
+			factory, err = callAddress(ctx, caller, pair.Address, encodeCall(SELECTOR_FACTORY))
+			var rpcErr *JsonRpcError
+			if err != nil && !errors.As(err, &rpcErr) {
+				return Protocol{}, err
+			}
+		}
+		r.factories[pair.Address] = factory
+	}
+	if factory != "" {
+		if protocol, ok := us.protocolByFactory(factory); ok {
+			return protocol, nil
+		}
+	}
+	protocol, _ := us.protocolBySymbol(pair.Id)
+	return protocol, nil
+}
+
+func (r eventLogReader) getToken(ctx context.Context, address string) (Token, error) {
+	if token, ok := r.tokens[strings.ToLower(address)]; ok {
+		return token, nil
+	}
+	caller, ok := r.pairReader.(ContractCaller)
+	if !ok {
+		return Token{}, fmt.Errorf("%w: cannot read token %s", ErrNotSupported, address)
+	}
+	token, err := callToken(ctx, caller, address)
+	if err != nil {
+		return Token{}, err
+	}
+	r.tokens[strings.ToLower(address)] = token
+	return token, nil
+}
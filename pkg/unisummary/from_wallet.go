@@ -1,46 +1,124 @@
 package unisummary
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"math"
+	"math/big"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func FromWalletAddress(us *UniswapSummaryRequest) []LiquidityProviderPosition {
+func FromWalletAddress(us *UniswapSummaryRequest) ([]LiquidityProviderPosition, error) {
+	return FromWalletAddressContext(context.Background(), us)
+}
 
-	normalTransactions := fetchAllNormalTransactions(us)
-	transactions := processNormalTransactions(normalTransactions)
+func FromWalletAddressContext(ctx context.Context, us *UniswapSummaryRequest) ([]LiquidityProviderPosition, error) {
 
-	tokenTransactions := fetchAllTokenTransactions(us)
-	transactions = processTokenTransactions(us, transactions, tokenTransactions)
+	normalTransactions, err := us.fetchNormalTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	internalTransactions := fetchAllInternalTransactions(us)
-	transactions = processInternalTransactions(us, transactions, internalTransactions)
+	tokenTransactions, err := us.fetchTokenTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	transactions = normalizeAndRemoveSwaps(transactions)
+	var events []LiquidityEvent
+	logSource, isLogSource := us.DataSource.(LogSource)
+	pairReader, isPairReader := us.DataSource.(PairReader)
+	if us.DecodeEventLogs && isLogSource && isPairReader {
+		events, err = liquidityEventsFromLogs(ctx, us, logSource, pairReader, normalTransactions, tokenTransactions)
+	} else {
+		events, err = liquidityEventsFromTransfers(ctx, us, normalTransactions, tokenTransactions)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		events, err = liquidityEventsFromTransfers(ctx, us, normalTransactions, tokenTransactions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	positions := makePositions(events, us.LotMatching)
+
+	return withStakingContracts(us, positions, normalTransactions, tokenTransactions), nil
+}
+
+// liquidityEventsFromTransfers infers liquidity events from router
+// transactions moving exactly two tokens and the LP token. Migrations from
+// Uniswap V1 are left out: the migrator deposits the tokens itself, so the
+// wallet transfers show no deposited quantities. They are only found from
+// the event logs
+func liquidityEventsFromTransfers(ctx context.Context, us *UniswapSummaryRequest, normalTransactions EtherscanNormalTransactionsResponse, tokenTransactions EtherscanTokenTransactionsResponse) ([]LiquidityEvent, error) {
+
+	transactions, err := processNormalTransactions(us, normalTransactions, tokenTransactions)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err = processTokenTransactions(us, transactions, tokenTransactions)
+	if err != nil {
+		return nil, err
+	}
 
-	positions := makePositions(transactions)
+	internalTransactions, err := us.fetchInternalTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	transactions, err = processInternalTransactions(us, transactions, internalTransactions)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions = normalizeAndRemoveSwaps(transactions)
 
-	return positions
+	return makeLiquidityEvents(us, transactions), nil
 }
 
-func makePositions(ts Transactions) []LiquidityProviderPosition {
-	var positions []LiquidityProviderPosition
+func makeLiquidityEvents(us *UniswapSummaryRequest, ts Transactions) []LiquidityEvent {
+	var events []LiquidityEvent
 	for _, t := range ts {
-		var token1, token2, pair int
+		pair, token1, token2 := -1, -1, -1
 		for i, tt := range t.TokenTransactions {
-			if tt.IsLiquidityProviderToken == true {
+			if tt.IsLiquidityProviderToken {
 				pair = i
-			} else if token1 == 0 {
+			} else if token1 < 0 {
 				token1 = i
 			} else {
 				token2 = i
 			}
 		}
-		p := LiquidityProviderPosition{
+		// Exactly one LP token and two underlying tokens
+		if pair < 0 || token2 < 0 {
+			continue
+		}
+		pairQuantity := NewTokenAmount(t.TokenTransactions[pair].Value, t.TokenTransactions[pair].TokenDecimal)
+		token1Quantity := NewTokenAmount(t.TokenTransactions[token1].Value, t.TokenTransactions[token1].TokenDecimal)
+		token2Quantity := NewTokenAmount(t.TokenTransactions[token2].Value, t.TokenTransactions[token2].TokenDecimal)
+		// LP tokens minted and burned in the same transaction
+		if pairQuantity.Sign() == 0 {
+			continue
+		}
+		eventType := AddLiquidity
+		if pairQuantity.Sign() < 0 {
+			eventType = RemoveLiquidity
+			pairQuantity = pairQuantity.Neg()
+		} else {
+			token1Quantity = token1Quantity.Neg()
+			token2Quantity = token2Quantity.Neg()
+		}
+		protocol, ok := us.protocolByRouter(t.To)
+		if !ok {
+			protocol, _ = us.protocolBySymbol(t.TokenTransactions[pair].TokenSymbol)
+		}
+		e := LiquidityEvent{
+			Protocol: protocol.Name,
+			Type:     eventType,
+			Hash:     t.Hash,
+			Block:    t.Block,
+			Date:     t.Date,
 			Pair: Token{
 				Id: t.TokenTransactions[pair].TokenSymbol +
 					" " + t.TokenTransactions[token1].TokenSymbol +
@@ -48,24 +126,24 @@ func makePositions(ts Transactions) []LiquidityProviderPosition {
 				Address:  t.TokenTransactions[pair].ContractAddress,
 				Decimals: t.TokenTransactions[pair].TokenDecimal,
 			},
-			PairQuantity: parseTokenFloatQuantity(t.TokenTransactions[pair].Value, t.TokenTransactions[pair].TokenDecimal),
 			Token1: Token{
 				Id:       t.TokenTransactions[token1].TokenSymbol,
 				Address:  t.TokenTransactions[token1].ContractAddress,
 				Decimals: t.TokenTransactions[token1].TokenDecimal,
 			},
-			Token1InitialQuantity: -parseTokenFloatQuantity(t.TokenTransactions[token1].Value, t.TokenTransactions[token1].TokenDecimal),
 			Token2: Token{
 				Id:       t.TokenTransactions[token2].TokenSymbol,
 				Address:  t.TokenTransactions[token2].ContractAddress,
 				Decimals: t.TokenTransactions[token2].TokenDecimal,
 			},
-			Token2InitialQuantity: -parseTokenFloatQuantity(t.TokenTransactions[token2].Value, t.TokenTransactions[token2].TokenDecimal),
-			InitialDate:           t.Date,
+			PairQuantity:   pairQuantity,
+			Token1Quantity: token1Quantity,
+			Token2Quantity: token2Quantity,
+			GasCost:        t.GasCost(),
 		}
-		positions = append(positions, p)
+		events = append(events, e)
 	}
-	return positions
+	return events
 }
 
 func normalizeAndRemoveSwaps(ts Transactions) Transactions {
@@ -74,15 +152,14 @@ func normalizeAndRemoveSwaps(ts Transactions) Transactions {
 		tokenTransactions := []TokenTransaction{}
 		for _, tt := range t.TokenTransactions {
 			exists := false
-			factor := 1.0
+			value := new(big.Int).Set(tt.Value)
 			if tt.SendOrReceive == send {
-				factor = -1.0
+				value.Neg(value)
 			}
-			value := factor * tt.Value
 			for j, a := range tokenTransactions {
 				if a.ContractAddress == tt.ContractAddress {
 					exists = true
-					tokenTransactions[j].Value += value
+					tokenTransactions[j].Value = new(big.Int).Add(a.Value, value)
 					break
 				}
 			}
@@ -102,16 +179,20 @@ func normalizeAndRemoveSwaps(ts Transactions) Transactions {
 	return swapsRemoved
 }
 
-func processInternalTransactions(us *UniswapSummaryRequest, ts Transactions, r EtherscanInternalTransactionsResponse) Transactions {
+func processInternalTransactions(us *UniswapSummaryRequest, ts Transactions, r EtherscanInternalTransactionsResponse) (Transactions, error) {
 	for i, t := range ts {
 		for _, tt := range r.Result {
 			if t.Hash == tt.Hash {
-				if tt.From == UNISWAP_CONTRACT_ADDRESS {
+				if us.isRecognizedContract(tt.From) {
+					value, err := toBigInt(tt.Value)
+					if err != nil {
+						return nil, err
+					}
 					tokenTransaction := TokenTransaction{
 						TokenSymbol:              "WETH",
 						TokenDecimal:             18,
 						ContractAddress:          TOKEN_WETH.Address,
-						Value:                    toFloat(tt.Value),
+						Value:                    value,
 						SendOrReceive:            receive,
 						IsLiquidityProviderToken: false,
 					}
@@ -120,33 +201,53 @@ func processInternalTransactions(us *UniswapSummaryRequest, ts Transactions, r E
 			}
 		}
 	}
-	return ts
+	return ts, nil
 }
 
-func processTokenTransactions(us *UniswapSummaryRequest, ts Transactions, r EtherscanTokenTransactionsResponse) Transactions {
+func processTokenTransactions(us *UniswapSummaryRequest, ts Transactions, r EtherscanTokenTransactionsResponse) (Transactions, error) {
+	tracked := map[string]bool{}
+	for _, t := range ts {
+		tracked[t.Hash] = true
+	}
+	attached := map[int]bool{}
 	for i, t := range ts {
-		for _, tt := range r.Result {
-			if t.Hash == tt.Hash {
-
-				isLpToken := false
-				if tt.TokenSymbol == LIQUIDITY_PROVIDER_TOKEN_SYMBOL {
-					isLpToken = true
+		for j, tt := range r.Result {
+			isDeposit := false
+			if t.DirectPair != "" && !tracked[tt.Hash] && !attached[j] {
+				date, err := toTime(tt.TimeStamp)
+				if err != nil {
+					return nil, err
 				}
+				// Calling a pair directly requires sending it the tokens
+				// in earlier transactions
+				isDeposit = us.isOwnAddress(tt.From) && icaseCompare(tt.To, t.DirectPair) && !date.After(t.Date)
+				attached[j] = isDeposit
+			}
+			if (t.Hash == tt.Hash || isDeposit) && !us.isInternalTransfer(tt.From, tt.To) {
+
+				isLpToken := us.isLiquidityProviderToken(tt.TokenSymbol)
 
 				sendOrReceive := send
-				if icaseCompare(tt.To, us.UserAddress) {
+				if us.isOwnAddress(tt.To) {
 					sendOrReceive = receive
-				} else if !icaseCompare(tt.From, us.UserAddress) {
-					fmt.Println(tt.To)
-					fmt.Println(tt.From)
-					panic("ERC20 token transaction TO or FROM should be equal the user wallet address")
+				} else if !us.isOwnAddress(tt.From) {
+					return nil, fmt.Errorf("%w: neither %s nor %s is the user wallet address in transaction %s", ErrUnexpectedTransfer, tt.From, tt.To, tt.Hash)
+				}
+
+				tokenDecimal, err := toInt(tt.TokenDecimal)
+				if err != nil {
+					return nil, err
+				}
+				value, err := toBigInt(tt.Value)
+				if err != nil {
+					return nil, err
 				}
 
 				tokenTransaction := TokenTransaction{
 					TokenSymbol:              tt.TokenSymbol,
-					TokenDecimal:             toInt(tt.TokenDecimal),
+					TokenDecimal:             tokenDecimal,
 					ContractAddress:          tt.ContractAddress,
-					Value:                    toFloat(tt.Value),
+					Value:                    value,
 					SendOrReceive:            sendOrReceive,
 					IsLiquidityProviderToken: isLpToken,
 				}
@@ -155,31 +256,63 @@ func processTokenTransactions(us *UniswapSummaryRequest, ts Transactions, r Ethe
 			}
 		}
 	}
-	return ts
+	return ts, nil
 }
 
-func processNormalTransactions(r EtherscanNormalTransactionsResponse) Transactions {
+func processNormalTransactions(us *UniswapSummaryRequest, r EtherscanNormalTransactionsResponse, tokenTransactions EtherscanTokenTransactionsResponse) (Transactions, error) {
 	ts := Transactions{}
 	for _, t := range r.Result {
 		if t.IsError == "0" && t.TxReceiptStatus == "1" {
-			if t.To == UNISWAP_CONTRACT_ADDRESS {
+			directPair := ""
+			isPairCall := strings.HasPrefix(t.Input, SELECTOR_PAIR_MINT) || strings.HasPrefix(t.Input, SELECTOR_PAIR_BURN)
+			if isPairCall && movesPairToken(us, tokenTransactions, t) {
+				directPair = t.To
+			}
+			if icaseCompare(t.To, UNISWAP_MIGRATOR_ADDRESS) {
+				log(fmt.Sprintf("Skipping migration %s, found only from event logs", t.Hash))
+				continue
+			}
+			if us.isRecognizedContract(t.To) || directPair != "" {
 				tokenTransactions := []TokenTransaction{}
 				if t.Value != "0" {
+					value, err := toBigInt(t.Value)
+					if err != nil {
+						return nil, err
+					}
 					tokenTransaction := TokenTransaction{
 						TokenSymbol:              "WETH",
 						TokenDecimal:             18,
 						ContractAddress:          TOKEN_WETH.Address,
-						Value:                    toFloat(t.Value),
+						Value:                    value,
 						SendOrReceive:            send,
 						IsLiquidityProviderToken: false,
 					}
 					tokenTransactions = append(tokenTransactions, tokenTransaction)
 				}
+				gasUsed, err := toBigInt(t.GasUsed)
+				if err != nil {
+					return nil, err
+				}
+				gasPrice, err := toBigInt(t.GasPrice)
+				if err != nil {
+					return nil, err
+				}
+				date, err := toTime(t.TimeStamp)
+				if err != nil {
+					return nil, err
+				}
+				block, err := toInt(t.BlockNumber)
+				if err != nil {
+					return nil, err
+				}
 				transaction := Transaction{
 					Hash:              t.Hash,
-					GasUsed:           toFloat(t.GasUsed),
-					GasPrice:          toFloat(t.GasPrice),
-					Date:              toTime(t.TimeStamp),
+					To:                t.To,
+					GasUsed:           gasUsed,
+					GasPrice:          gasPrice,
+					Block:             uint64(block),
+					Date:              date,
+					DirectPair:        directPair,
 					TokenTransactions: tokenTransactions,
 				}
 				ts = append(ts, transaction)
@@ -187,52 +320,39 @@ func processNormalTransactions(r EtherscanNormalTransactionsResponse) Transactio
 		}
 
 	}
-	return ts
+	return ts, nil
 }
 
-func toInt(str string) int {
-	f, err := strconv.ParseInt(str, 10, 64)
-	handleError(err)
-	return int(f)
+// movesPairToken tells whether the called contract is a pair, as other
+// contracts share the mint(address) and burn(address) selectors. Minting
+// sends the pair's LP token to the wallet in the same transaction, while
+// burning needs it sent to the pair beforehand
+func movesPairToken(us *UniswapSummaryRequest, tokenTransactions EtherscanTokenTransactionsResponse, t EtherscanNormalTransaction) bool {
+	for _, tt := range tokenTransactions.Result {
+		if !icaseCompare(tt.ContractAddress, t.To) || !us.isLiquidityProviderToken(tt.TokenSymbol) {
+			continue
+		}
+		if tt.Hash == t.Hash || (us.isOwnAddress(tt.From) && icaseCompare(tt.To, t.To)) {
+			return true
+		}
+	}
+	return false
 }
 
-func toFloat(str string) float64 {
-	f, err := strconv.ParseFloat(str, 64)
-	handleError(err)
-	return f
+func toInt(str string) (int, error) {
+	f, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, malformed("invalid integer %q", str)
+	}
+	return int(f), nil
 }
 
-func toTime(timestamp string) time.Time {
+func toTime(timestamp string) (time.Time, error) {
 	i, err := strconv.ParseInt(timestamp, 10, 64)
-	handleError(err)
-	return time.Unix(i, 0)
-}
-
-func fetchAllInternalTransactions(us *UniswapSummaryRequest) EtherscanInternalTransactionsResponse {
-	endpoint := fmt.Sprintf(us.EtherscanInternalTransactionsEndpoint, us.EtherscanApiKey, us.UserAddress)
-	responseBody := callEndpoint(endpoint)
-	var response EtherscanInternalTransactionsResponse
-	err := json.Unmarshal([]byte(responseBody), &response)
-	handleError(err)
-	return response
-}
-
-func fetchAllTokenTransactions(us *UniswapSummaryRequest) EtherscanTokenTransactionsResponse {
-	endpoint := fmt.Sprintf(us.EtherscanTokenTransactionsEndpoint, us.EtherscanApiKey, us.UserAddress)
-	responseBody := callEndpoint(endpoint)
-	var response EtherscanTokenTransactionsResponse
-	err := json.Unmarshal([]byte(responseBody), &response)
-	handleError(err)
-	return response
-}
-
-func fetchAllNormalTransactions(us *UniswapSummaryRequest) EtherscanNormalTransactionsResponse {
-	endpoint := fmt.Sprintf(us.EtherscanNormalTransactionsEndpoint, us.EtherscanApiKey, us.UserAddress)
-	responseBody := callEndpoint(endpoint)
-	var response EtherscanNormalTransactionsResponse
-	err := json.Unmarshal([]byte(responseBody), &response)
-	handleError(err)
-	return response
+	if err != nil {
+		return time.Time{}, malformed("invalid timestamp %q", timestamp)
+	}
+	return time.Unix(i, 0), nil
 }
 
 type Transactions []Transaction
@@ -247,12 +367,22 @@ func (ts Transactions) Hashes() []string {
 
 type Transaction struct {
 	Hash              string
-	GasUsed           float64
-	GasPrice          float64
+	To                string
+	GasUsed           *big.Int
+	GasPrice          *big.Int
+	Block             uint64
 	Date              time.Time
+	DirectPair        string
 	TokenTransactions []TokenTransaction
 }
 
+func (t Transaction) GasCost() TokenAmount {
+	if t.GasUsed == nil || t.GasPrice == nil {
+		return NewTokenAmount(new(big.Int), TOKEN_WETH.Decimals)
+	}
+	return NewTokenAmount(new(big.Int).Mul(t.GasUsed, t.GasPrice), TOKEN_WETH.Decimals)
+}
+
 type SendOrReceive string
 
 var send = SendOrReceive("send")
@@ -262,7 +392,7 @@ type TokenTransaction struct {
 	TokenSymbol              string
 	TokenDecimal             int
 	ContractAddress          string
-	Value                    float64
+	Value                    *big.Int
 	SendOrReceive            SendOrReceive
 	IsLiquidityProviderToken bool
 }
@@ -270,7 +400,3 @@ type TokenTransaction struct {
 func icaseCompare(a, b string) bool {
 	return strings.ToLower(a) == strings.ToLower(b)
 }
-
-func parseTokenFloatQuantity(quantity float64, decimals int) float64 {
-	return quantity * math.Pow(10, -float64(decimals))
-}
@@ -0,0 +1,82 @@
+package unisummary
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestProcessNormalTransactionsDirectPair(t *testing.T) {
+	us := &UniswapSummaryRequest{UserAddress: testWallet, Protocols: DEFAULT_PROTOCOLS}
+	const nft = "0x0000000000000000000000000000000000000eee"
+	call := func(hash string, to string, selector string) EtherscanNormalTransaction {
+		return EtherscanNormalTransaction{
+			Hash: hash, To: to, Input: selector + encodeAddress(testWallet), Value: "0",
+			IsError: "0", TxReceiptStatus: "1", GasUsed: "1", GasPrice: "1", TimeStamp: "1", BlockNumber: "1",
+		}
+	}
+	lpTransfer := func(hash string, from string, to string) EtherscanTokenTransaction {
+		return EtherscanTokenTransaction{Hash: hash, From: from, To: to, ContractAddress: testPair, TokenSymbol: LIQUIDITY_PROVIDER_TOKEN_SYMBOL}
+	}
+	tokens := EtherscanTokenTransactionsResponse{Result: []EtherscanTokenTransaction{
+		lpTransfer("0x01", "0x0000000000000000000000000000000000000000", testWallet),
+		lpTransfer("0x02", testWallet, testPair),
+	}}
+
+	tests := []struct {
+		name string
+		call EtherscanNormalTransaction
+		want string
+	}{
+		{"pair mint", call("0x01", testPair, SELECTOR_PAIR_MINT), testPair},
+		{"pair burn after sending the LP token", call("0x03", testPair, SELECTOR_PAIR_BURN), testPair},
+		{"mint on another contract", call("0x04", nft, SELECTOR_PAIR_MINT), ""},
+		{"burn on another contract", call("0x05", nft, SELECTOR_PAIR_BURN), ""},
+	}
+	for _, test := range tests {
+		ts, err := processNormalTransactions(us, EtherscanNormalTransactionsResponse{Result: []EtherscanNormalTransaction{test.call}}, tokens)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got := ""
+		if len(ts) > 0 {
+			got = ts[0].DirectPair
+		}
+		if got != test.want {
+			t.Errorf("%s: DirectPair = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProcessNormalTransactionsSkipsMigrations(t *testing.T) {
+	us := &UniswapSummaryRequest{UserAddress: testWallet, Protocols: DEFAULT_PROTOCOLS}
+	migration := EtherscanNormalTransaction{
+		Hash: "0x01", To: UNISWAP_MIGRATOR_ADDRESS, Value: "0",
+		IsError: "0", TxReceiptStatus: "1", GasUsed: "1", GasPrice: "1", TimeStamp: "1", BlockNumber: "1",
+	}
+	ts, err := processNormalTransactions(us, EtherscanNormalTransactionsResponse{Result: []EtherscanNormalTransaction{migration}}, EtherscanTokenTransactionsResponse{})
+	if err != nil || len(ts) != 0 {
+		t.Errorf("processNormalTransactions = %+v, %v, want no transactions", ts, err)
+	}
+}
+
+func TestMakeLiquidityEventsWithoutLpToken(t *testing.T) {
+	us := &UniswapSummaryRequest{UserAddress: testWallet, Protocols: DEFAULT_PROTOCOLS}
+	transfer := func(symbol string, isLpToken bool) TokenTransaction {
+		return TokenTransaction{TokenSymbol: symbol, TokenDecimal: 18, Value: big.NewInt(1), SendOrReceive: receive, IsLiquidityProviderToken: isLpToken}
+	}
+	// LP tokens minted and burned in the same transaction
+	minted := transfer(LIQUIDITY_PROVIDER_TOKEN_SYMBOL, true)
+	minted.Value = new(big.Int)
+	ts := Transactions{
+		{Hash: "0x01", TokenTransactions: []TokenTransaction{transfer("AAA", false), transfer("BBB", false), transfer("CCC", false)}},
+		{Hash: "0x02", TokenTransactions: []TokenTransaction{transfer("AAA", false), transfer(LIQUIDITY_PROVIDER_TOKEN_SYMBOL, true), transfer("BBB", false)}},
+		{Hash: "0x03", TokenTransactions: []TokenTransaction{transfer("AAA", false), minted, transfer("BBB", false)}},
+	}
+	events := makeLiquidityEvents(us, ts)
+	if len(events) != 1 || events[0].Hash != "0x02" {
+		t.Fatalf("events = %+v, want only 0x02", events)
+	}
+	if events[0].Token1.Id != "AAA" || events[0].Token2.Id != "BBB" {
+		t.Errorf("tokens = %s, %s, want AAA, BBB", events[0].Token1.Id, events[0].Token2.Id)
+	}
+}
@@ -0,0 +1,211 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PriceTime is a past moment, by block and/or date. Oracles use whichever
+// they support
+type PriceTime struct {
+	Block uint64
+	Date  time.Time
+}
+
+type HistoricalPriceOracle interface {
+	PriceOracle
+	PriceAt(ctx context.Context, token Token, at PriceTime) (*big.Rat, error)
+}
+
+// PriceAt reads the pair reserves as of the block, which for old blocks
+// requires an archive node
+func (o PairPriceOracle) PriceAt(ctx context.Context, token Token, at PriceTime) (*big.Rat, error) {
+	blockCalls, ok := o.Caller.(BlockContractCaller)
+	if !ok || at.Block == 0 {
+		return nil, fmt.Errorf("%w: pair prices at a past date require calls at a block", ErrNotSupported)
+	}
+	caller := blockCaller{blockCalls, at.Block}
+	o.Caller = caller
+	o.Reader = callPairReader{caller}
+	return o.Price(ctx, token)
+}
+
+// callPairReader reads pairs through plain contract calls
+type callPairReader struct {
+	caller ContractCaller
+}
+
+func (r callPairReader) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	return callGetReserves(ctx, r.caller, pairAddress)
+}
+
+func (r callPairReader) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, r.caller, pairAddress, encodeCall(SELECTOR_TOKEN0))
+}
+
+func (r callPairReader) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, r.caller, pairAddress, encodeCall(SELECTOR_TOKEN1))
+}
+
+type PricePoint struct {
+	Date  time.Time
+	Price *big.Rat
+}
+
+// HistoricalPriceTable prices tokens from dated prices, keyed by token
+// address or symbol. The price at a date is the last one not after it
+type HistoricalPriceTable struct {
+	QuoteToken Token
+	Prices     map[string][]PricePoint
+}
+
+func (o HistoricalPriceTable) Quote() Token {
+	return o.QuoteToken
+}
+
+func (o HistoricalPriceTable) Price(ctx context.Context, token Token) (*big.Rat, error) {
+	return o.PriceAt(ctx, token, PriceTime{Date: time.Now()})
+}
+
+func (o HistoricalPriceTable) PriceAt(ctx context.Context, token Token, at PriceTime) (*big.Rat, error) {
+	if icaseCompare(token.Address, o.QuoteToken.Address) {
+		return big.NewRat(1, 1), nil
+	}
+	if at.Date.IsZero() {
+		return nil, fmt.Errorf("%w: price table lookups require a date", ErrNotSupported)
+	}
+	points, ok := o.Prices[token.Id]
+	for key, p := range o.Prices {
+		if icaseCompare(key, token.Address) {
+			points, ok = p, true
+			break
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not in the price table", ErrNoPrice, token.Id)
+	}
+	index := sort.Search(len(points), func(i int) bool { return points[i].Date.After(at.Date) })
+	if index == 0 {
+		return nil, fmt.Errorf("%w: no price of %s at %s", ErrNoPrice, token.Id, at.Date.Format(time.RFC3339))
+	}
+	return points[index-1].Price, nil
+}
+
+// LoadHistoricalPriceCsv reads token,date,price rows, with dates as unix
+// timestamps, 2006-01-02 or RFC 3339. A header row is skipped
+func LoadHistoricalPriceCsv(path string, quote Token) (HistoricalPriceTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return HistoricalPriceTable{}, err
+	}
+	defer file.Close()
+	table := HistoricalPriceTable{quote, map[string][]PricePoint{}}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 3
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return HistoricalPriceTable{}, err
+		}
+		price, ok := new(big.Rat).SetString(strings.TrimSpace(record[2]))
+		if !ok && line == 1 {
+			continue
+		}
+		if !ok {
+			return HistoricalPriceTable{}, fmt.Errorf("%s:%d: invalid price %q", path, line, record[2])
+		}
+		date, err := parsePriceDate(strings.TrimSpace(record[1]))
+		if err != nil {
+			return HistoricalPriceTable{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		key := strings.TrimSpace(record[0])
+		table.Prices[key] = append(table.Prices[key], PricePoint{date, price})
+	}
+	for _, points := range table.Prices {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Date.Before(points[j].Date) })
+	}
+	return table, nil
+}
+
+func parsePriceDate(value string) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
+
+// withDepositValues values the deposits of a response at the prices of
+// the time each lot was added
+func withDepositValues(ctx context.Context, oracle HistoricalPriceOracle, response UniswapSummaryResponse) (UniswapSummaryResponse, error) {
+	lots := response.Token.Lots
+	if len(lots) == 0 {
+		for _, c := range response.Token.ClosedLots {
+			lots = append(lots, c.Lot)
+		}
+	}
+	if len(lots) == 0 {
+		lots = []Lot{{
+			Token1Quantity: response.Token.Token1InitialQuantity,
+			Token2Quantity: response.Token.Token2InitialQuantity,
+			Block:          response.Token.InitialBlock,
+			Date:           response.Token.InitialDate,
+		}}
+	}
+	depositValue := new(big.Rat)
+	for _, lot := range lots {
+		at := PriceTime{lot.Block, lot.Date}
+		price1, err := oracle.PriceAt(ctx, response.Token.Token1, at)
+		if err != nil {
+			return response, err
+		}
+		price2, err := oracle.PriceAt(ctx, response.Token.Token2, at)
+		if err != nil {
+			return response, err
+		}
+		depositValue.Add(depositValue, valueIn(lot.Token1Quantity, price1, lot.Token2Quantity, price2))
+	}
+	response.DepositValue = TokenAmountFromRat(depositValue, oracle.Quote().Decimals)
+	response.DepositProfitValue = response.CurrentValue.Sub(response.DepositValue)
+	if depositValue.Sign() != 0 {
+		response.DepositReturn = (ratFloat64(new(big.Rat).Quo(response.CurrentValue.Rat(), depositValue)) - 1.0) * 100.0
+	}
+	return response, nil
+}
+
+// withOptionalDepositValues leaves the deposit values unset when the
+// oracle cannot price the deposit time, with the reason in DepositError
+// unless the oracle has no past prices at all
+func withOptionalDepositValues(ctx context.Context, oracle PriceOracle, response UniswapSummaryResponse) UniswapSummaryResponse {
+	historical, ok := oracle.(HistoricalPriceOracle)
+	if !ok {
+		return response
+	}
+	valued, err := withDepositValues(ctx, historical, response)
+	if errors.Is(err, ErrNotSupported) {
+		return response
+	}
+	if err != nil {
+		response.DepositError = err.Error()
+		return response
+	}
+	return valued
+}
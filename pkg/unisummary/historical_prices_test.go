@@ -0,0 +1,51 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestWithDepositValues(t *testing.T) {
+	deposit := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	aaa := Token{"AAA", testToken0, 0}
+	bbb := Token{"BBB", testToken1, 0}
+	table := HistoricalPriceTable{TOKEN_USDC, map[string][]PricePoint{
+		"AAA": {{deposit, big.NewRat(2, 1)}},
+		"BBB": {{deposit, big.NewRat(3, 1)}},
+	}}
+	position := func(quantity int64) UniswapSummaryResponse {
+		return UniswapSummaryResponse{
+			Token: LiquidityProviderPosition{
+				Token1: aaa, Token2: bbb, InitialDate: deposit,
+				Token1InitialQuantity: NewTokenAmount(big.NewInt(quantity), 0),
+				Token2InitialQuantity: NewTokenAmount(big.NewInt(quantity), 0),
+			},
+			CurrentValue: NewTokenAmount(big.NewInt(600), 0),
+		}
+	}
+	tests := []struct {
+		name        string
+		response    UniswapSummaryResponse
+		depositRet  float64
+		depositText string
+	}{
+		{"deposit", position(100), 20, "500"},
+		{"nothing deposited", position(0), 0, "0"},
+	}
+	for _, test := range tests {
+		valued, err := withDepositValues(context.Background(), table, test.response)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if math.Abs(valued.DepositReturn-test.depositRet) > 1e-9 || valued.DepositValue.String() != test.depositText {
+			t.Errorf("%s: DepositValue = %s, DepositReturn = %v", test.name, valued.DepositValue, valued.DepositReturn)
+		}
+		if _, err := json.Marshal(valued); err != nil {
+			t.Errorf("%s: json.Marshal: %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package unisummary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+)
+
+type JsonRpcDataSource struct {
+	Endpoint string
+	Client   *http.Client
+	// Ethereum nodes cannot list wallet transactions, so the transaction
+	// history is delegated to this source when set (e.g. Etherscan)
+	Transactions ChainDataSource
+}
+
+func NewJsonRpcDataSource(endpoint string, transactions ChainDataSource) *JsonRpcDataSource {
+	return &JsonRpcDataSource{
+		Endpoint:     endpoint,
+		Client:       client,
+		Transactions: transactions,
+	}
+}
+
+type JsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *JsonRpcError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+type jsonRpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Id      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type jsonRpcResponse struct {
+	Id     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *JsonRpcError   `json:"error"`
+}
+
+var jsonRpcId uint64
+
+func (rpc JsonRpcDataSource) callRpc(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	requestBody, err := json.Marshal(jsonRpcRequest{
+		JsonRpc: "2.0",
+		Id:      atomic.AddUint64(&jsonRpcId, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	log(fmt.Sprintf("Calling %s on %s...", method, rpc.Endpoint))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rpc.Endpoint, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	httpClient := rpc.Client
+	if httpClient == nil {
+		httpClient = client
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRequestFailed, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: http status %d", ErrRequestFailed, resp.StatusCode)
+	}
+	var response jsonRpcResponse
+	err = json.Unmarshal(bodyBytes, &response)
+	if err != nil {
+		return malformed("%s", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if len(response.Result) == 0 {
+		return malformed("expecting property `result`")
+	}
+	err = json.Unmarshal(response.Result, result)
+	if err != nil {
+		return malformed("%s", err)
+	}
+	return nil
+}
+
+func (rpc JsonRpcDataSource) Call(ctx context.Context, to string, data string) (string, error) {
+	var result string
+	params := []interface{}{map[string]string{"to": to, "data": data}, "latest"}
+	err := rpc.callRpc(ctx, "eth_call", params, &result)
+	return result, err
+}
+
+// CallAtBlock needs an archive node for blocks older than the pruning
+// window of the node
+func (rpc JsonRpcDataSource) CallAtBlock(ctx context.Context, to string, data string, block uint64) (string, error) {
+	var result string
+	params := []interface{}{map[string]string{"to": to, "data": data}, toHex(block)}
+	err := rpc.callRpc(ctx, "eth_call", params, &result)
+	return result, err
+}
+
+func (rpc JsonRpcDataSource) GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error) {
+	return callBalanceOf(ctx, rpc, tokenAddress, walletAddress)
+}
+
+func (rpc JsonRpcDataSource) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	return callTotalSupply(ctx, rpc, tokenAddress)
+}
+
+func (rpc JsonRpcDataSource) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	return callGetReserves(ctx, rpc, pairAddress)
+}
+
+func (rpc JsonRpcDataSource) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, rpc, pairAddress, encodeCall(SELECTOR_TOKEN0))
+}
+
+func (rpc JsonRpcDataSource) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return callAddress(ctx, rpc, pairAddress, encodeCall(SELECTOR_TOKEN1))
+}
+
+type jsonRpcLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+}
+
+// Logs returned by nodes carry no timestamp, so Log.TimeStamp is left zero
+func (rpc JsonRpcDataSource) GetLogs(ctx context.Context, query LogQuery) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": toHex(query.FromBlock),
+		"toBlock":   toHex(query.ToBlock),
+	}
+	if query.Address != "" {
+		filter["address"] = query.Address
+	}
+	if len(query.Topics) > 0 {
+		topics := []interface{}{}
+		for _, topic := range query.Topics {
+			if topic == "" {
+				topics = append(topics, nil)
+			} else {
+				topics = append(topics, topic)
+			}
+		}
+		filter["topics"] = topics
+	}
+	var result []jsonRpcLog
+	err := rpc.callRpc(ctx, "eth_getLogs", []interface{}{filter}, &result)
+	if err != nil {
+		return nil, err
+	}
+	logs := []Log{}
+	for _, l := range result {
+		blockNumber, err := parseHexUint64(l.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		logIndex, err := parseHexUint64(l.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, Log{
+			Address:         l.Address,
+			Topics:          l.Topics,
+			Data:            l.Data,
+			BlockNumber:     blockNumber,
+			TransactionHash: l.TransactionHash,
+			LogIndex:        logIndex,
+		})
+	}
+	return logs, nil
+}
+
+func (rpc JsonRpcDataSource) GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error) {
+	if rpc.Transactions == nil {
+		return EtherscanNormalTransactionsResponse{}, ErrNotSupported
+	}
+	return rpc.Transactions.GetNormalTransactions(ctx, walletAddress)
+}
+
+func (rpc JsonRpcDataSource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	if rpc.Transactions == nil {
+		return EtherscanTokenTransactionsResponse{}, ErrNotSupported
+	}
+	return rpc.Transactions.GetTokenTransactions(ctx, walletAddress)
+}
+
+func (rpc JsonRpcDataSource) GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error) {
+	if rpc.Transactions == nil {
+		return EtherscanInternalTransactionsResponse{}, ErrNotSupported
+	}
+	return rpc.Transactions.GetInternalTransactions(ctx, walletAddress)
+}
+
+func (rpc JsonRpcDataSource) GetNormalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanNormalTransactionsResponse, error) {
+	rangeSource, ok := rpc.Transactions.(TransactionRangeSource)
+	if !ok {
+		return EtherscanNormalTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetNormalTransactionsFrom(ctx, walletAddress, startBlock)
+}
+
+func (rpc JsonRpcDataSource) GetTokenTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanTokenTransactionsResponse, error) {
+	rangeSource, ok := rpc.Transactions.(TransactionRangeSource)
+	if !ok {
+		return EtherscanTokenTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetTokenTransactionsFrom(ctx, walletAddress, startBlock)
+}
+
+func (rpc JsonRpcDataSource) GetInternalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanInternalTransactionsResponse, error) {
+	rangeSource, ok := rpc.Transactions.(TransactionRangeSource)
+	if !ok {
+		return EtherscanInternalTransactionsResponse{}, ErrNotSupported
+	}
+	return rangeSource.GetInternalTransactionsFrom(ctx, walletAddress, startBlock)
+}
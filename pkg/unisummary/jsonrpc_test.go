@@ -0,0 +1,92 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPair = "0x0000000000000000000000000000000000000aaa"
+const testToken0 = "0x0000000000000000000000000000000000000bbb"
+const testToken1 = "0x0000000000000000000000000000000000000ccc"
+const testWallet = "0x0000000000000000000000000000000000000ddd"
+
+// newJsonRpcStandIn answers eth_call with the result registered for the
+// call data, and with a JSON-RPC error for unknown calls
+func newJsonRpcStandIn(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Id     uint64
+			Method string
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error(err)
+			return
+		}
+		var call struct{ To, Data string }
+		if request.Method == "eth_call" {
+			json.Unmarshal(request.Params[0], &call)
+		}
+		result, ok := results[call.To+call.Data]
+		if !ok {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"error":{"code":-32000,"message":"execution reverted"}}`, request.Id)
+			return
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":"%s"}`, request.Id, result)
+	}))
+}
+
+func TestJsonRpcDataSource(t *testing.T) {
+	server := newJsonRpcStandIn(t, map[string]string{
+		testPair + encodeCall(SELECTOR_BALANCE_OF, encodeAddress(testWallet)): "0x" + leftPad("64"),
+		testPair + encodeCall(SELECTOR_TOTAL_SUPPLY):                          "0x" + leftPad("3e8"),
+		testPair + encodeCall(SELECTOR_GET_RESERVES):                          "0x" + leftPad("7d0") + leftPad("bb8") + leftPad("5f5e100"),
+		testPair + encodeCall(SELECTOR_TOKEN0):                                "0x" + leftPad(testToken0[2:]),
+		testPair + encodeCall(SELECTOR_TOKEN1):                                "0x" + leftPad(testToken1[2:]),
+	})
+	defer server.Close()
+	rpc := NewJsonRpcDataSource(server.URL, nil)
+	ctx := context.Background()
+
+	balance, err := rpc.GetBalance(ctx, testPair, testWallet)
+	if err != nil || balance != "100" {
+		t.Errorf("GetBalance = %q, %v", balance, err)
+	}
+	supply, err := rpc.GetSupply(ctx, testPair)
+	if err != nil || supply != "1000" {
+		t.Errorf("GetSupply = %q, %v", supply, err)
+	}
+	reserve0, reserve1, err := rpc.GetReserves(ctx, testPair)
+	if err != nil || reserve0 != "2000" || reserve1 != "3000" {
+		t.Errorf("GetReserves = %q, %q, %v", reserve0, reserve1, err)
+	}
+	token0, err := rpc.GetToken0(ctx, testPair)
+	if err != nil || token0 != testToken0 {
+		t.Errorf("GetToken0 = %q, %v", token0, err)
+	}
+	token1, err := rpc.GetToken1(ctx, testPair)
+	if err != nil || token1 != testToken1 {
+		t.Errorf("GetToken1 = %q, %v", token1, err)
+	}
+}
+
+func TestJsonRpcDataSourceError(t *testing.T) {
+	server := newJsonRpcStandIn(t, map[string]string{})
+	defer server.Close()
+	rpc := NewJsonRpcDataSource(server.URL, nil)
+
+	_, err := rpc.GetSupply(context.Background(), testPair)
+	var rpcErr *JsonRpcError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("GetSupply error = %v, want a JsonRpcError", err)
+	}
+	if rpcErr.Code != -32000 || !strings.Contains(rpcErr.Message, "reverted") {
+		t.Errorf("GetSupply error = %+v", rpcErr)
+	}
+}
@@ -0,0 +1,211 @@
+package unisummary
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type LiquidityEventType string
+
+var AddLiquidity = LiquidityEventType("add")
+var RemoveLiquidity = LiquidityEventType("remove")
+
+// LiquidityEvent is a single add or removal of liquidity. All quantities
+// are positive: tokens deposited for adds and tokens received for removals
+type LiquidityEvent struct {
+	Protocol       string
+	Type           LiquidityEventType
+	Hash           string
+	Block          uint64
+	Date           time.Time
+	Pair           Token
+	Token1         Token
+	Token2         Token
+	PairQuantity   TokenAmount
+	Token1Quantity TokenAmount
+	Token2Quantity TokenAmount
+	GasCost        TokenAmount
+}
+
+// alignedTo swaps the event tokens so that token1 comes first
+func (e LiquidityEvent) alignedTo(token1 Token) LiquidityEvent {
+	if !icaseCompare(e.Token1.Address, token1.Address) {
+		e.Token1, e.Token2 = e.Token2, e.Token1
+		e.Token1Quantity, e.Token2Quantity = e.Token2Quantity, e.Token1Quantity
+	}
+	return e
+}
+
+// Lot is a single liquidity add, or what is left of it after removals.
+// Quantities of a position are the sum of its open lots
+type Lot struct {
+	Hash           string
+	PairQuantity   TokenAmount
+	Token1Quantity TokenAmount
+	Token2Quantity TokenAmount
+	Block          uint64
+	Date           time.Time
+	GasCost        TokenAmount
+}
+
+// ClosedLot is the part of a lot withdrawn by a removal, along with the
+// tokens received for it
+type ClosedLot struct {
+	Lot
+	CloseHash           string
+	CloseDate           time.Time
+	Token1FinalQuantity TokenAmount
+	Token2FinalQuantity TokenAmount
+	CloseGasCost        TokenAmount
+}
+
+type LotMatching string
+
+var FIFO = LotMatching("fifo")
+var LIFO = LotMatching("lifo")
+
+func makePositions(events []LiquidityEvent, matching LotMatching) []LiquidityProviderPosition {
+	var positions []LiquidityProviderPosition
+	for _, e := range events {
+		index := -1
+		for i, p := range positions {
+			if icaseCompare(p.Pair.Address, e.Pair.Address) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			positions = append(positions, LiquidityProviderPosition{
+				Protocol:     e.Protocol,
+				Pair:         e.Pair,
+				Token1:       e.Token1,
+				Token2:       e.Token2,
+				InitialBlock: e.Block,
+				InitialDate:  e.Date,
+			})
+			index = len(positions) - 1
+		}
+		e = e.alignedTo(positions[index].Token1)
+		positions[index].Events = append(positions[index].Events, e)
+		if e.Type == AddLiquidity {
+			positions[index].Lots = append(positions[index].Lots, Lot{
+				Hash:           e.Hash,
+				PairQuantity:   e.PairQuantity,
+				Token1Quantity: e.Token1Quantity,
+				Token2Quantity: e.Token2Quantity,
+				Block:          e.Block,
+				Date:           e.Date,
+				GasCost:        e.GasCost,
+			})
+		} else {
+			positions[index] = positions[index].removeLiquidity(e, matching)
+		}
+		positions[index] = positions[index].withLotTotals()
+	}
+	withLiquidity := []LiquidityProviderPosition{}
+	for _, p := range positions {
+		if len(p.Lots) > 0 || len(p.ClosedLots) > 0 {
+			withLiquidity = append(withLiquidity, p)
+		}
+	}
+	return withLiquidity
+}
+
+// removeLiquidity closes lots, in the order given by matching, until the
+// LP tokens of the removal are accounted for
+func (p LiquidityProviderPosition) removeLiquidity(e LiquidityEvent, matching LotMatching) LiquidityProviderPosition {
+	lots := append([]Lot{}, p.Lots...)
+	left := e.PairQuantity.Rat()
+	for left.Sign() > 0 && len(lots) > 0 {
+		index := 0
+		if matching == LIFO {
+			index = len(lots) - 1
+		}
+		lot := lots[index]
+		// A lot without LP tokens has nothing to close
+		if lot.PairQuantity.Sign() == 0 {
+			lots = append(lots[:index], lots[index+1:]...)
+			continue
+		}
+		taken := new(big.Rat).Set(left)
+		if lot.PairQuantity.Rat().Cmp(taken) < 0 {
+			taken = lot.PairQuantity.Rat()
+		}
+		lotShare := new(big.Rat).Quo(taken, lot.PairQuantity.Rat())
+		eventShare := new(big.Rat).Quo(taken, e.PairQuantity.Rat())
+		closed := ClosedLot{
+			Lot: Lot{
+				Hash:           lot.Hash,
+				PairQuantity:   TokenAmountFromRat(taken, lot.PairQuantity.Decimals),
+				Token1Quantity: scaleAmount(lot.Token1Quantity, lotShare),
+				Token2Quantity: scaleAmount(lot.Token2Quantity, lotShare),
+				Block:          lot.Block,
+				Date:           lot.Date,
+				GasCost:        scaleAmount(lot.GasCost, lotShare),
+			},
+			CloseHash:           e.Hash,
+			CloseDate:           e.Date,
+			Token1FinalQuantity: scaleAmount(e.Token1Quantity, eventShare),
+			Token2FinalQuantity: scaleAmount(e.Token2Quantity, eventShare),
+			CloseGasCost:        scaleAmount(e.GasCost, eventShare),
+		}
+		p.ClosedLots = append(p.ClosedLots, closed)
+		lot.PairQuantity = lot.PairQuantity.Sub(closed.PairQuantity)
+		lot.Token1Quantity = lot.Token1Quantity.Sub(closed.Token1Quantity)
+		lot.Token2Quantity = lot.Token2Quantity.Sub(closed.Token2Quantity)
+		lot.GasCost = lot.GasCost.Sub(closed.GasCost)
+		if lot.PairQuantity.IsZero() {
+			lots = append(lots[:index], lots[index+1:]...)
+		} else {
+			lots[index] = lot
+		}
+		left.Sub(left, taken)
+	}
+	if left.Sign() > 0 {
+		log(fmt.Sprintf("Removal %s of %s has no matching liquidity add", e.Hash, p.Pair.Id))
+	}
+	p.Lots = lots
+	return p
+}
+
+// withLotTotals sets the position quantities from its open lots
+func (p LiquidityProviderPosition) withLotTotals() LiquidityProviderPosition {
+	p.PairQuantity = NewTokenAmount(new(big.Int), p.Pair.Decimals)
+	p.Token1InitialQuantity = NewTokenAmount(new(big.Int), p.Token1.Decimals)
+	p.Token2InitialQuantity = NewTokenAmount(new(big.Int), p.Token2.Decimals)
+	p.GasCost = NewTokenAmount(new(big.Int), TOKEN_WETH.Decimals)
+	for i, lot := range p.Lots {
+		p.PairQuantity = p.PairQuantity.Add(lot.PairQuantity)
+		p.Token1InitialQuantity = p.Token1InitialQuantity.Add(lot.Token1Quantity)
+		p.Token2InitialQuantity = p.Token2InitialQuantity.Add(lot.Token2Quantity)
+		p.GasCost = p.GasCost.Add(lot.GasCost)
+		if i == 0 || lot.Date.Before(p.InitialDate) {
+			p.InitialDate = lot.Date
+			p.InitialBlock = lot.Block
+		}
+	}
+	return p
+}
+
+func (p LiquidityProviderPosition) IsClosed() bool {
+	return len(p.Lots) == 0 && len(p.ClosedLots) > 0
+}
+
+// lotPosition returns a position made of a single lot of p
+func (p LiquidityProviderPosition) lotPosition(lot Lot) LiquidityProviderPosition {
+	p.PairQuantity = lot.PairQuantity
+	p.Token1InitialQuantity = lot.Token1Quantity
+	p.Token2InitialQuantity = lot.Token2Quantity
+	p.InitialDate = lot.Date
+	p.InitialBlock = lot.Block
+	p.GasCost = lot.GasCost
+	p.Lots = nil
+	p.ClosedLots = nil
+	p.Events = nil
+	return p
+}
+
+func scaleAmount(a TokenAmount, factor *big.Rat) TokenAmount {
+	return TokenAmountFromRat(new(big.Rat).Mul(a.Rat(), factor), a.Decimals)
+}
@@ -0,0 +1,126 @@
+package unisummary
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMakePositionsPartialRemovals(t *testing.T) {
+	pair := Token{"UNI-V2", testPair, 0}
+	aaa := Token{"AAA", testToken0, 0}
+	bbb := Token{"BBB", testToken1, 0}
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	event := func(eventType LiquidityEventType, hash string, date time.Time, lp, quantity1, quantity2 int64) LiquidityEvent {
+		return LiquidityEvent{
+			Type: eventType, Hash: hash, Date: date, Pair: pair, Token1: aaa, Token2: bbb,
+			PairQuantity:   NewTokenAmount(big.NewInt(lp), 0),
+			Token1Quantity: NewTokenAmount(big.NewInt(quantity1), 0),
+			Token2Quantity: NewTokenAmount(big.NewInt(quantity2), 0),
+			GasCost:        NewTokenAmount(new(big.Int), TOKEN_WETH.Decimals),
+		}
+	}
+	adds := []LiquidityEvent{
+		event(AddLiquidity, "a", day(1), 10, 100, 200),
+		event(AddLiquidity, "b", day(2), 20, 300, 600),
+	}
+	removal := event(RemoveLiquidity, "r", day(3), 15, 150, 300)
+	// Tokens reported in the other order, as pair logs may do
+	swapped := removal
+	swapped.Token1, swapped.Token2 = bbb, aaa
+	swapped.Token1Quantity, swapped.Token2Quantity = removal.Token2Quantity, removal.Token1Quantity
+
+	tests := []struct {
+		name     string
+		removal  LiquidityEvent
+		matching LotMatching
+		// hash:lp:token1:token2 of the open lots, and the same plus the
+		// received token1:token2 for the closed ones
+		open   []string
+		closed []string
+	}{
+		{"fifo", removal, FIFO,
+			[]string{"b:15:225:450"},
+			[]string{"a:10:100:200:100:200", "b:5:75:150:50:100"}},
+		{"lifo", removal, LIFO,
+			[]string{"a:10:100:200", "b:5:75:150"},
+			[]string{"b:15:225:450:150:300"}},
+		{"fifo with swapped tokens", swapped, FIFO,
+			[]string{"b:15:225:450"},
+			[]string{"a:10:100:200:100:200", "b:5:75:150:50:100"}},
+		{"removal of everything", event(RemoveLiquidity, "r", day(3), 30, 300, 600), FIFO,
+			nil,
+			[]string{"a:10:100:200:100:200", "b:20:300:600:200:400"}},
+	}
+	for _, test := range tests {
+		positions := makePositions(append(append([]LiquidityEvent{}, adds...), test.removal), test.matching)
+		if len(positions) != 1 {
+			t.Fatalf("%s: %d positions, want 1", test.name, len(positions))
+		}
+		p := positions[0]
+		var open, closed []string
+		for _, lot := range p.Lots {
+			open = append(open, fmt.Sprintf("%s:%s:%s:%s", lot.Hash, lot.PairQuantity, lot.Token1Quantity, lot.Token2Quantity))
+		}
+		for _, c := range p.ClosedLots {
+			closed = append(closed, fmt.Sprintf("%s:%s:%s:%s:%s:%s", c.Hash, c.PairQuantity, c.Token1Quantity, c.Token2Quantity, c.Token1FinalQuantity, c.Token2FinalQuantity))
+		}
+		if !reflect.DeepEqual(open, test.open) || !reflect.DeepEqual(closed, test.closed) {
+			t.Errorf("%s: open lots %v, closed lots %v, want %v and %v", test.name, open, closed, test.open, test.closed)
+		}
+		if p.IsClosed() != (len(test.open) == 0) {
+			t.Errorf("%s: IsClosed = %v", test.name, p.IsClosed())
+		}
+	}
+}
+
+func TestMakePositionsEdgeCases(t *testing.T) {
+	pair := Token{"UNI-V2", testPair, 0}
+	aaa := Token{"AAA", testToken0, 0}
+	bbb := Token{"BBB", testToken1, 0}
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(eventType LiquidityEventType, hash string, lp, quantity1, quantity2 int64) LiquidityEvent {
+		return LiquidityEvent{
+			Type: eventType, Hash: hash, Date: date, Pair: pair, Token1: aaa, Token2: bbb,
+			PairQuantity:   NewTokenAmount(big.NewInt(lp), 0),
+			Token1Quantity: NewTokenAmount(big.NewInt(quantity1), 0),
+			Token2Quantity: NewTokenAmount(big.NewInt(quantity2), 0),
+			GasCost:        NewTokenAmount(new(big.Int), TOKEN_WETH.Decimals),
+		}
+	}
+	tests := []struct {
+		name   string
+		events []LiquidityEvent
+		closed int
+	}{
+		{"lot without LP tokens", []LiquidityEvent{
+			event(AddLiquidity, "a", 0, 0, 0),
+			event(AddLiquidity, "b", 5, 50, 100),
+			event(RemoveLiquidity, "r", 3, 30, 60),
+		}, 1},
+		{"add and removal in the same block", []LiquidityEvent{
+			event(AddLiquidity, "a", 5, 50, 100),
+			event(RemoveLiquidity, "r", 5, 55, 100),
+		}, 1},
+	}
+	for _, test := range tests {
+		positions := makePositions(test.events, FIFO)
+		if len(positions) != 1 || len(positions[0].ClosedLots) != test.closed {
+			t.Fatalf("%s: positions = %+v, want %d closed lot", test.name, positions, test.closed)
+		}
+		responses := []UniswapSummaryResponse{makeClosedResponse(positions[0])}
+		responses = append(responses, responses[0].Realized...)
+		for _, r := range responses {
+			if math.IsInf(r.YearlyProfit, 0) || math.IsNaN(r.YearlyProfit) || math.IsInf(r.YearlyProfitNetOfGas, 0) {
+				t.Errorf("%s: YearlyProfit = %v, YearlyProfitNetOfGas = %v", test.name, r.YearlyProfit, r.YearlyProfitNetOfGas)
+			}
+		}
+		if _, err := json.Marshal(responses); err != nil {
+			t.Errorf("%s: json.Marshal: %v", test.name, err)
+		}
+	}
+}
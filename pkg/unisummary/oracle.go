@@ -0,0 +1,350 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+)
+
+const SELECTOR_GET_PAIR = "0xe6a43905"
+
+var ErrNoPrice = errors.New("no price")
+
+var TOKEN_USDC = Token{"USDC", "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", 6}
+
+// PriceOracle prices tokens in a quote currency, e.g. USD through a
+// stablecoin
+type PriceOracle interface {
+	Quote() Token
+	// Price of one whole token in whole quote units
+	Price(ctx context.Context, token Token) (*big.Rat, error)
+}
+
+// PairPriceOracle prices tokens from Uniswap V2 pair reserves. A token
+// without a route is priced through its pair with the quote, or else
+// through its pair with WETH and the WETH route. Token decimals are
+// remembered only by oracles made with NewPairPriceOracle
+type PairPriceOracle struct {
+	Reader     PairReader
+	Caller     ContractCaller
+	Factory    string
+	QuoteToken Token
+	// Pair addresses leading from a token (by address) to the quote
+	Routes map[string][]string
+	mutex  *sync.Mutex
+	tokens map[string]Token
+}
+
+func NewPairPriceOracle(source ChainDataSource, quote Token, routes map[string][]string) (PairPriceOracle, error) {
+	reader, isPairReader := source.(PairReader)
+	caller, isCaller := source.(ContractCaller)
+	if !isPairReader || !isCaller {
+		return PairPriceOracle{}, fmt.Errorf("%w: pair prices require pair reserves and contract calls", ErrNotSupported)
+	}
+	if routes == nil {
+		routes = map[string][]string{}
+	}
+	return PairPriceOracle{
+		Reader:     reader,
+		Caller:     caller,
+		Factory:    UNISWAP_V2_FACTORY_ADDRESS,
+		QuoteToken: quote,
+		Routes:     routes,
+		mutex:      &sync.Mutex{},
+		tokens:     map[string]Token{},
+	}, nil
+}
+
+// NewUsdPriceOracle prices tokens in USDC, routing WETH through the
+// Uniswap V2 ETH/USDC pair
+func NewUsdPriceOracle(source ChainDataSource) (PairPriceOracle, error) {
+	return NewPairPriceOracle(source, TOKEN_USDC, map[string][]string{
+		TOKEN_WETH.Address: {"0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc"},
+	})
+}
+
+func (o PairPriceOracle) Quote() Token {
+	return o.QuoteToken
+}
+
+func (o PairPriceOracle) Price(ctx context.Context, token Token) (*big.Rat, error) {
+	if icaseCompare(token.Address, o.QuoteToken.Address) {
+		return big.NewRat(1, 1), nil
+	}
+	route, err := o.route(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	price := big.NewRat(1, 1)
+	current := strings.ToLower(token.Address)
+	for _, pair := range route {
+		hopPrice, next, err := o.pairPrice(ctx, pair, current)
+		if err != nil {
+			return nil, err
+		}
+		price.Mul(price, hopPrice)
+		current = next
+	}
+	if !icaseCompare(current, o.QuoteToken.Address) {
+		return nil, fmt.Errorf("%w: route of %s ends in %s, not %s", ErrNoPrice, token.Id, current, o.QuoteToken.Id)
+	}
+	return price, nil
+}
+
+func (o PairPriceOracle) route(ctx context.Context, token Token) ([]string, error) {
+	for address, route := range o.Routes {
+		if icaseCompare(address, token.Address) {
+			return route, nil
+		}
+	}
+	pair, err := o.getPair(ctx, token.Address, o.QuoteToken.Address)
+	if err != nil {
+		return nil, err
+	}
+	if pair != "" {
+		return []string{pair}, nil
+	}
+	if icaseCompare(token.Address, TOKEN_WETH.Address) {
+		return nil, fmt.Errorf("%w: no route for %s", ErrNoPrice, token.Id)
+	}
+	pair, err = o.getPair(ctx, token.Address, TOKEN_WETH.Address)
+	if err != nil {
+		return nil, err
+	}
+	if pair == "" {
+		return nil, fmt.Errorf("%w: no route for %s", ErrNoPrice, token.Id)
+	}
+	wethRoute, err := o.route(ctx, TOKEN_WETH)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{pair}, wethRoute...), nil
+}
+
+func (o PairPriceOracle) getPair(ctx context.Context, tokenA, tokenB string) (string, error) {
+	pair, err := callAddress(ctx, o.Caller, o.Factory, encodeCall(SELECTOR_GET_PAIR, encodeAddress(tokenA), encodeAddress(tokenB)))
+	if err != nil {
+		return "", err
+	}
+	if icaseCompare(pair, ZERO_ADDRESS) {
+		return "", nil
+	}
+	return pair, nil
+}
+
+// pairPrice returns the price of a pair token in the other one, and the
+// other token
+func (o PairPriceOracle) pairPrice(ctx context.Context, pair string, token string) (*big.Rat, string, error) {
+	token0, err := o.Reader.GetToken0(ctx, pair)
+	if err != nil {
+		return nil, "", err
+	}
+	token1, err := o.Reader.GetToken1(ctx, pair)
+	if err != nil {
+		return nil, "", err
+	}
+	reserve0, reserve1, err := o.Reader.GetReserves(ctx, pair)
+	if err != nil {
+		return nil, "", err
+	}
+	if icaseCompare(token, token1) {
+		token0, token1 = token1, token0
+		reserve0, reserve1 = reserve1, reserve0
+	} else if !icaseCompare(token, token0) {
+		return nil, "", malformed("pair %s does not hold %s", pair, token)
+	}
+	decimals0, err := o.decimals(ctx, token0)
+	if err != nil {
+		return nil, "", err
+	}
+	decimals1, err := o.decimals(ctx, token1)
+	if err != nil {
+		return nil, "", err
+	}
+	amount0, err := ParseTokenAmount(reserve0, decimals0)
+	if err != nil {
+		return nil, "", err
+	}
+	amount1, err := ParseTokenAmount(reserve1, decimals1)
+	if err != nil {
+		return nil, "", err
+	}
+	if amount0.IsZero() {
+		return nil, "", fmt.Errorf("%w: pair %s has no liquidity", ErrNoPrice, pair)
+	}
+	return new(big.Rat).Quo(amount1.Rat(), amount0.Rat()), strings.ToLower(token1), nil
+}
+
+func (o PairPriceOracle) decimals(ctx context.Context, address string) (int, error) {
+	if o.mutex == nil {
+		token, err := callToken(ctx, o.Caller, address)
+		return token.Decimals, err
+	}
+	key := strings.ToLower(address)
+	o.mutex.Lock()
+	token, ok := o.tokens[key]
+	o.mutex.Unlock()
+	if !ok {
+		var err error
+		token, err = callToken(ctx, o.Caller, address)
+		if err != nil {
+			return 0, err
+		}
+		o.mutex.Lock()
+		o.tokens[key] = token
+		o.mutex.Unlock()
+	}
+	return token.Decimals, nil
+}
+
+// StaticPriceOracle prices tokens from a fixed table, keyed by token
+// address or symbol
+type StaticPriceOracle struct {
+	QuoteToken Token
+	Prices     map[string]*big.Rat
+}
+
+func (o StaticPriceOracle) Quote() Token {
+	return o.QuoteToken
+}
+
+func (o StaticPriceOracle) Price(ctx context.Context, token Token) (*big.Rat, error) {
+	if icaseCompare(token.Address, o.QuoteToken.Address) {
+		return big.NewRat(1, 1), nil
+	}
+	for key, price := range o.Prices {
+		if icaseCompare(key, token.Address) {
+			return price, nil
+		}
+	}
+	if price, ok := o.Prices[token.Id]; ok {
+		return price, nil
+	}
+	return nil, fmt.Errorf("%w: %s is not in the price table", ErrNoPrice, token.Id)
+}
+
+// LoadPriceFile reads a JSON object of prices, e.g. {"WETH": "1850.25"}
+func LoadPriceFile(path string, quote Token) (StaticPriceOracle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return StaticPriceOracle{}, err
+	}
+	defer file.Close()
+	var table map[string]json.Number
+	if err := json.NewDecoder(file).Decode(&table); err != nil {
+		return StaticPriceOracle{}, err
+	}
+	oracle := StaticPriceOracle{quote, map[string]*big.Rat{}}
+	for key, value := range table {
+		price, ok := new(big.Rat).SetString(value.String())
+		if !ok {
+			return StaticPriceOracle{}, fmt.Errorf("%s: invalid price %q for %s", path, value, key)
+		}
+		oracle.Prices[key] = price
+	}
+	return oracle, nil
+}
+
+// LoadPriceCsv reads token,price rows. A header row is skipped
+func LoadPriceCsv(path string, quote Token) (StaticPriceOracle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return StaticPriceOracle{}, err
+	}
+	defer file.Close()
+	oracle := StaticPriceOracle{quote, map[string]*big.Rat{}}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return StaticPriceOracle{}, err
+		}
+		price, ok := new(big.Rat).SetString(strings.TrimSpace(record[1]))
+		if !ok {
+			if line == 1 {
+				continue
+			}
+			return StaticPriceOracle{}, fmt.Errorf("%s:%d: invalid price %q", path, line, record[1])
+		}
+		oracle.Prices[strings.TrimSpace(record[0])] = price
+	}
+	return oracle, nil
+}
+
+// withQuoteValues values a response, its lots and its realized lots in
+// the oracle quote currency at current prices. A response that cannot be
+// priced keeps its token figures, with the quote values unset and the
+// reason in QuoteError
+func withQuoteValues(ctx context.Context, oracle PriceOracle, response UniswapSummaryResponse) UniswapSummaryResponse {
+	valued, err := quoteValues(ctx, oracle, response)
+	if err != nil {
+		response.QuoteError = err.Error()
+		return response
+	}
+	return valued
+}
+
+func quoteValues(ctx context.Context, oracle PriceOracle, response UniswapSummaryResponse) (UniswapSummaryResponse, error) {
+	quote := oracle.Quote()
+	price1, err := oracle.Price(ctx, response.Token.Token1)
+	if err != nil {
+		return response, err
+	}
+	price2, err := oracle.Price(ctx, response.Token.Token2)
+	if err != nil {
+		return response, err
+	}
+	initialValue := valueIn(response.Token.Token1InitialQuantity, price1, response.Token.Token2InitialQuantity, price2)
+	currentValue := valueIn(response.Token1FinalQuantity, price1, response.Token2FinalQuantity, price2)
+	response.InitialValue = TokenAmountFromRat(initialValue, quote.Decimals)
+	response.CurrentValue = TokenAmountFromRat(currentValue, quote.Decimals)
+	response.FeesValue = TokenAmountFromRat(valueIn(response.Token1Fee, price1, response.Token2Fee, price2), quote.Decimals)
+	response.ProfitValue = response.CurrentValue.Sub(response.InitialValue)
+	rewardsValue := new(big.Rat)
+	for _, r := range response.Rewards {
+		price, err := oracle.Price(ctx, r.Contract.RewardToken)
+		if err != nil {
+			return response, err
+		}
+		rewardsValue.Add(rewardsValue, new(big.Rat).Mul(r.Quantity.Rat(), price))
+	}
+	response.RewardsValue = TokenAmountFromRat(rewardsValue, quote.Decimals)
+	for _, b := range []*Benchmark{&response.Hodl, &response.Lp, &response.LpVsHodl, &response.AllToken1, &response.AllToken2} {
+		b.Quote = TokenAmountFromRat(new(big.Rat).Mul(b.Token1.Rat(), price1), quote.Decimals)
+	}
+	if !response.HasNetOfGas && response.GasCost.Sign() != 0 && response.InitialValue.Sign() != 0 {
+		// Pairs without WETH, whose own prices cannot value gas. Without a
+		// WETH price the net figures are left unset
+		if gasPrice, err := oracle.Price(ctx, TOKEN_WETH); err == nil {
+			gasValue := new(big.Rat).Mul(response.GasCost.Rat(), gasPrice)
+			response = withNetOfGas(response, ratFloat64(new(big.Rat).Quo(gasValue, response.InitialValue.Rat()))*100.0)
+		}
+	}
+	response = withOptionalDepositValues(ctx, oracle, response)
+	// Lots are copied, leaving those of the unpriced response untouched
+	response.Lots = withQuoteValuesEach(ctx, oracle, response.Lots)
+	response.Realized = withQuoteValuesEach(ctx, oracle, response.Realized)
+	return response, nil
+}
+
+func withQuoteValuesEach(ctx context.Context, oracle PriceOracle, responses []UniswapSummaryResponse) []UniswapSummaryResponse {
+	if len(responses) == 0 {
+		return responses
+	}
+	valued := make([]UniswapSummaryResponse, len(responses))
+	for i, r := range responses {
+		valued[i] = withQuoteValues(ctx, oracle, r)
+	}
+	return valued
+}
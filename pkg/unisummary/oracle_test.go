@@ -0,0 +1,75 @@
+package unisummary
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestWithQuoteValuesWithoutPrice(t *testing.T) {
+	aaa := Token{"AAA", testToken0, 18}
+	bbb := Token{"BBB", testToken1, 18}
+	lot := UniswapSummaryResponse{
+		Token:               LiquidityProviderPosition{Token1: aaa, Token2: bbb},
+		Token1FinalQuantity: NewTokenAmount(big.NewInt(1e18), 18),
+		Token2FinalQuantity: NewTokenAmount(big.NewInt(1e18), 18),
+	}
+	response := lot
+	response.Lots = []UniswapSummaryResponse{lot}
+
+	priced := StaticPriceOracle{TOKEN_USDC, map[string]*big.Rat{"AAA": big.NewRat(2, 1), "BBB": big.NewRat(3, 1)}}
+	valued := withQuoteValues(context.Background(), priced, response)
+	if valued.QuoteError != "" || valued.CurrentValue.String() != "5" || valued.Lots[0].CurrentValue.String() != "5" {
+		t.Errorf("priced: CurrentValue = %s, lot %s, QuoteError %q", valued.CurrentValue, valued.Lots[0].CurrentValue, valued.QuoteError)
+	}
+
+	unpriced := StaticPriceOracle{TOKEN_USDC, map[string]*big.Rat{"AAA": big.NewRat(2, 1)}}
+	valued = withQuoteValues(context.Background(), unpriced, response)
+	if !strings.Contains(valued.QuoteError, "BBB") {
+		t.Errorf("unpriced: QuoteError = %q, want the missing token", valued.QuoteError)
+	}
+	if !valued.CurrentValue.IsZero() || valued.Token1FinalQuantity.String() != "1" {
+		t.Errorf("unpriced: CurrentValue = %s, Token1FinalQuantity = %s", valued.CurrentValue, valued.Token1FinalQuantity)
+	}
+	if response.Lots[0].QuoteError != "" || !response.Lots[0].CurrentValue.IsZero() {
+		t.Errorf("the lots of the original response were modified")
+	}
+}
+
+// noHistoryOracle prices tokens now but fails at any past date
+type noHistoryOracle struct {
+	StaticPriceOracle
+	err error
+}
+
+func (o noHistoryOracle) PriceAt(ctx context.Context, token Token, at PriceTime) (*big.Rat, error) {
+	return nil, o.err
+}
+
+func TestWithQuoteValuesWithoutDepositPrice(t *testing.T) {
+	response := UniswapSummaryResponse{
+		Token:               LiquidityProviderPosition{Token1: Token{"AAA", testToken0, 18}, Token2: Token{"BBB", testToken1, 18}},
+		Token1FinalQuantity: NewTokenAmount(big.NewInt(1e18), 18),
+		Token2FinalQuantity: NewTokenAmount(big.NewInt(1e18), 18),
+	}
+	static := StaticPriceOracle{TOKEN_USDC, map[string]*big.Rat{"AAA": big.NewRat(2, 1), "BBB": big.NewRat(3, 1)}}
+	tests := []struct {
+		name         string
+		err          error
+		depositError string
+	}{
+		{"no past prices", ErrNotSupported, ""},
+		{"missing state", &JsonRpcError{Code: -32000, Message: "missing trie node"}, "missing trie node"},
+		{"no price at the deposit date", ErrNoPrice, ErrNoPrice.Error()},
+	}
+	for _, test := range tests {
+		valued := withQuoteValues(context.Background(), noHistoryOracle{static, test.err}, response)
+		if valued.QuoteError != "" || valued.CurrentValue.String() != "5" {
+			t.Errorf("%s: CurrentValue = %s, QuoteError %q", test.name, valued.CurrentValue, valued.QuoteError)
+		}
+		if !strings.Contains(valued.DepositError, test.depositError) || (test.depositError == "") != (valued.DepositError == "") {
+			t.Errorf("%s: DepositError = %q, want %q", test.name, valued.DepositError, test.depositError)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package unisummary
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// PortfolioSummary aggregates open positions, valued in a quote token at
+// the prices implied by the positions themselves. Percentages are weighted
+// by the value of each position
+type PortfolioSummary struct {
+	Quote Token
+	// Current value of the positions, excluding uncollected rewards
+	Value TokenAmount
+	// Value the initial quantities would have if simply held
+	HodlValue TokenAmount
+	// Fees still in the open positions, fees withdrawn with closed lots of
+	// open or closed positions, and their sum
+	Fees           TokenAmount
+	RealizedFees   TokenAmount
+	TotalFees      TokenAmount
+	Rewards        TokenAmount
+	DivergenceLoss float64
+	AccruedProfit  float64
+	DaysEllapsed   float64
+	YearlyProfit   float64
+	Exposure       []TokenExposure
+	// Positions with no price route to the quote token, left out of the
+	// totals
+	Unpriced []UniswapSummaryResponse
+}
+
+type TokenExposure struct {
+	Token    Token
+	Quantity TokenAmount
+	Value    TokenAmount
+}
+
+// SummarizePortfolio totals the open responses. Closed responses only
+// count towards the realized fees, see SplitClosed
+func SummarizePortfolio(responses []UniswapSummaryResponse, quote Token) PortfolioSummary {
+	open, closed := SplitClosed(responses)
+	prices := newPriceGraph(open).pricesIn(quote)
+	// Tokens no longer held are priced as of their withdrawal
+	realizedPrices := newPriceGraph(append(append([]UniswapSummaryResponse{}, open...), closed...)).pricesIn(quote)
+	for token, price := range prices {
+		realizedPrices[token] = price
+	}
+
+	portfolio := PortfolioSummary{Quote: quote}
+	value := new(big.Rat)
+	hodlValue := new(big.Rat)
+	fees := new(big.Rat)
+	rewards := new(big.Rat)
+	divergence := 0.0
+	days := 0.0
+	exposure := map[string]*TokenExposure{}
+	for _, r := range open {
+		price1, ok1 := prices[strings.ToLower(r.Token.Token1.Address)]
+		price2, ok2 := prices[strings.ToLower(r.Token.Token2.Address)]
+		if !ok1 || !ok2 {
+			portfolio.Unpriced = append(portfolio.Unpriced, r)
+			continue
+		}
+		positionValue := valueIn(r.Token1FinalQuantity, price1, r.Token2FinalQuantity, price2)
+		positionHodlValue := valueIn(r.Token.Token1InitialQuantity, price1, r.Token.Token2InitialQuantity, price2)
+		value.Add(value, positionValue)
+		hodlValue.Add(hodlValue, positionHodlValue)
+		fees.Add(fees, valueIn(r.Token1Fee, price1, r.Token2Fee, price2))
+		for _, reward := range r.Rewards {
+			if price, ok := prices[strings.ToLower(reward.Contract.RewardToken.Address)]; ok {
+				rewards.Add(rewards, new(big.Rat).Mul(reward.Quantity.Rat(), price))
+			}
+		}
+		divergence += r.DivergenceLoss * ratFloat64(positionValue)
+		days += r.DaysEllapsed * ratFloat64(positionHodlValue)
+		addExposure(exposure, r.Token.Token1, r.Token1FinalQuantity, price1, quote)
+		addExposure(exposure, r.Token.Token2, r.Token2FinalQuantity, price2, quote)
+	}
+
+	realizedFees := new(big.Rat)
+	for _, r := range responses {
+		if len(r.Realized) == 0 {
+			continue
+		}
+		price1, ok1 := realizedPrices[strings.ToLower(r.Token.Token1.Address)]
+		price2, ok2 := realizedPrices[strings.ToLower(r.Token.Token2.Address)]
+		if !ok1 || !ok2 {
+			// Open positions are already reported as unpriced
+			if r.Closed {
+				portfolio.Unpriced = append(portfolio.Unpriced, r)
+			}
+			continue
+		}
+		for _, lot := range r.Realized {
+			realizedFees.Add(realizedFees, valueIn(lot.Token1Fee, price1, lot.Token2Fee, price2))
+		}
+	}
+
+	portfolio.Value = TokenAmountFromRat(value, quote.Decimals)
+	portfolio.HodlValue = TokenAmountFromRat(hodlValue, quote.Decimals)
+	portfolio.Fees = TokenAmountFromRat(fees, quote.Decimals)
+	portfolio.RealizedFees = TokenAmountFromRat(realizedFees, quote.Decimals)
+	portfolio.TotalFees = TokenAmountFromRat(new(big.Rat).Add(fees, realizedFees), quote.Decimals)
+	portfolio.Rewards = TokenAmountFromRat(rewards, quote.Decimals)
+	// Percentages stay zero with nothing priced to weight them by
+	if value.Sign() != 0 {
+		portfolio.DivergenceLoss = divergence / ratFloat64(value)
+	}
+	if hodlValue.Sign() != 0 {
+		portfolio.AccruedProfit = (ratFloat64(new(big.Rat).Quo(value, hodlValue)) - 1.0) * 100.0
+		portfolio.DaysEllapsed = days / ratFloat64(hodlValue)
+	}
+	if portfolio.DaysEllapsed > 0 {
+		portfolio.YearlyProfit = (math.Pow(1.0+portfolio.AccruedProfit/100.0, 365.0/portfolio.DaysEllapsed) - 1.0) * 100.0
+	}
+	for _, r := range open {
+		for _, t := range []Token{r.Token.Token1, r.Token.Token2} {
+			if e, ok := exposure[strings.ToLower(t.Address)]; ok {
+				portfolio.Exposure = append(portfolio.Exposure, *e)
+				delete(exposure, strings.ToLower(t.Address))
+			}
+		}
+	}
+	return portfolio
+}
+
+func valueIn(quantity1 TokenAmount, price1 *big.Rat, quantity2 TokenAmount, price2 *big.Rat) *big.Rat {
+	value := new(big.Rat).Mul(quantity1.Rat(), price1)
+	return value.Add(value, new(big.Rat).Mul(quantity2.Rat(), price2))
+}
+
+func addExposure(exposure map[string]*TokenExposure, token Token, quantity TokenAmount, price *big.Rat, quote Token) {
+	key := strings.ToLower(token.Address)
+	e, ok := exposure[key]
+	if !ok {
+		e = &TokenExposure{Token: token}
+		exposure[key] = e
+	}
+	e.Quantity = e.Quantity.Add(quantity)
+	e.Value = e.Value.Add(TokenAmountFromRat(new(big.Rat).Mul(quantity.Rat(), price), quote.Decimals))
+}
+
+// priceGraph links the two tokens of every pair with the pair price, so a
+// token is priced in the quote through a chain of pairs
+type priceGraph map[string]map[string]*big.Rat
+
+func newPriceGraph(responses []UniswapSummaryResponse) priceGraph {
+	g := priceGraph{}
+	for _, r := range responses {
+		quantity1 := r.Token1FinalQuantity.Rat()
+		quantity2 := r.Token2FinalQuantity.Rat()
+		if quantity1.Sign() == 0 || quantity2.Sign() == 0 {
+			continue
+		}
+		token1 := strings.ToLower(r.Token.Token1.Address)
+		token2 := strings.ToLower(r.Token.Token2.Address)
+		g.add(token2, token1, new(big.Rat).Quo(quantity1, quantity2))
+		g.add(token1, token2, new(big.Rat).Quo(quantity2, quantity1))
+	}
+	return g
+}
+
+// add records the price of one token in units of the other
+func (g priceGraph) add(token, in string, price *big.Rat) {
+	if g[token] == nil {
+		g[token] = map[string]*big.Rat{}
+	}
+	if _, ok := g[token][in]; !ok {
+		g[token][in] = price
+	}
+}
+
+// pricesIn walks the graph breadth first from the quote, so every token is
+// priced through the shortest chain of pairs
+func (g priceGraph) pricesIn(quote Token) map[string]*big.Rat {
+	start := strings.ToLower(quote.Address)
+	prices := map[string]*big.Rat{start: big.NewRat(1, 1)}
+	tokens := []string{}
+	for token := range g {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	queue := []string{start}
+	for len(queue) > 0 {
+		in := queue[0]
+		queue = queue[1:]
+		for _, token := range tokens {
+			if _, done := prices[token]; done {
+				continue
+			}
+			if price, ok := g[token][in]; ok {
+				prices[token] = new(big.Rat).Mul(price, prices[in])
+				queue = append(queue, token)
+			}
+		}
+	}
+	return prices
+}
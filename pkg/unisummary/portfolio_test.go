@@ -0,0 +1,57 @@
+package unisummary
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestSummarizePortfolioWithoutPricedPositions(t *testing.T) {
+	unpriced := UniswapSummaryResponse{Token: LiquidityProviderPosition{
+		Token1: Token{"AAA", testToken0, 18},
+		Token2: Token{"BBB", testToken1, 18},
+	}}
+	for _, responses := range [][]UniswapSummaryResponse{nil, {unpriced}} {
+		portfolio := SummarizePortfolio(responses, TOKEN_USDC)
+		if portfolio.DivergenceLoss != 0 || portfolio.AccruedProfit != 0 || portfolio.DaysEllapsed != 0 || portfolio.YearlyProfit != 0 {
+			t.Errorf("SummarizePortfolio(%d responses) = %+v, want zero percentages", len(responses), portfolio)
+		}
+		if _, err := json.Marshal(portfolio); err != nil {
+			t.Errorf("json.Marshal: %v", err)
+		}
+	}
+}
+
+func TestSummarizePortfolioRealizedFees(t *testing.T) {
+	usd := Token{"USD", "0x0000000000000000000000000000000000000eee", 0}
+	aaa := Token{"AAA", testToken0, 0}
+	bbb := Token{"BBB", testToken1, 0}
+	amount := func(quantity int64) TokenAmount { return NewTokenAmount(big.NewInt(quantity), 0) }
+	response := func(token1, token2 Token, final1, final2, fee1, fee2 int64) UniswapSummaryResponse {
+		return UniswapSummaryResponse{
+			Token:               LiquidityProviderPosition{Token1: token1, Token2: token2},
+			Token1FinalQuantity: amount(final1), Token2FinalQuantity: amount(final2),
+			Token1Fee: amount(fee1), Token2Fee: amount(fee2),
+		}
+	}
+	// AAA is worth 2 USD now, BBB 3 USD when last withdrawn
+	open := response(aaa, usd, 100, 200, 1, 2)
+	open.Realized = []UniswapSummaryResponse{response(aaa, usd, 10, 20, 1, 0)}
+	closed := response(bbb, usd, 10, 30, 0, 0)
+	closed.Closed = true
+	closed.Realized = []UniswapSummaryResponse{response(bbb, usd, 10, 30, 1, 1)}
+	unpriced := response(Token{"CCC", testPair, 0}, Token{"DDD", testWallet, 0}, 1, 1, 1, 1)
+	unpriced.Closed = true
+	unpriced.Realized = []UniswapSummaryResponse{unpriced}
+
+	portfolio := SummarizePortfolio([]UniswapSummaryResponse{open, closed, unpriced}, usd)
+	if portfolio.Value.String() != "400" || portfolio.Fees.String() != "4" {
+		t.Errorf("Value = %s, Fees = %s, want 400 and 4 from the open position", portfolio.Value, portfolio.Fees)
+	}
+	if portfolio.RealizedFees.String() != "6" || portfolio.TotalFees.String() != "10" {
+		t.Errorf("RealizedFees = %s, TotalFees = %s, want 6 and 10", portfolio.RealizedFees, portfolio.TotalFees)
+	}
+	if len(portfolio.Unpriced) != 1 || portfolio.Unpriced[0].Token.Token1.Id != "CCC" {
+		t.Errorf("Unpriced = %+v, want the CCC position", portfolio.Unpriced)
+	}
+}
@@ -0,0 +1,81 @@
+package unisummary
+
+// Protocol describes a Uniswap V2 style DEX. All of them share the
+// constant product math, so positions are summarized the same way
+type Protocol struct {
+	Name string
+	// Routers, migrators and other contracts used to add or remove liquidity
+	RouterAddresses              []string
+	FactoryAddress               string
+	LiquidityProviderTokenSymbol string
+	// Share of each swap paid to liquidity providers, e.g. 0.003. It is
+	// informational: fees are measured from the growth of the pair
+	// constant product, whatever the tier
+	FeeTier float64
+}
+
+var UNISWAP_V2 = Protocol{
+	Name:                         "Uniswap V2",
+	RouterAddresses:              UNISWAP_V2_CONTRACTS,
+	FactoryAddress:               UNISWAP_V2_FACTORY_ADDRESS,
+	LiquidityProviderTokenSymbol: LIQUIDITY_PROVIDER_TOKEN_SYMBOL,
+	FeeTier:                      0.003,
+}
+
+var SUSHISWAP = Protocol{
+	Name:                         "SushiSwap",
+	RouterAddresses:              []string{SUSHISWAP_ROUTER_ADDRESS},
+	FactoryAddress:               SUSHISWAP_FACTORY_ADDRESS,
+	LiquidityProviderTokenSymbol: SUSHISWAP_LIQUIDITY_PROVIDER_TOKEN_SYMBOL,
+	FeeTier:                      0.0025,
+}
+
+var DEFAULT_PROTOCOLS = []Protocol{UNISWAP_V2, SUSHISWAP}
+
+func (us UniswapSummaryRequest) protocolByRouter(address string) (Protocol, bool) {
+	for _, p := range us.Protocols {
+		for _, router := range p.RouterAddresses {
+			if icaseCompare(router, address) {
+				return p, true
+			}
+		}
+	}
+	return Protocol{}, false
+}
+
+func (us UniswapSummaryRequest) protocolByFactory(address string) (Protocol, bool) {
+	for _, p := range us.Protocols {
+		if p.FactoryAddress != "" && icaseCompare(p.FactoryAddress, address) {
+			return p, true
+		}
+	}
+	return Protocol{}, false
+}
+
+// Forks often reuse the same LP token symbol, so the first matching
+// protocol wins when neither the router nor the factory is known
+func (us UniswapSummaryRequest) protocolBySymbol(symbol string) (Protocol, bool) {
+	for _, p := range us.Protocols {
+		if p.LiquidityProviderTokenSymbol == symbol {
+			return p, true
+		}
+	}
+	return Protocol{}, false
+}
+
+func (us UniswapSummaryRequest) isRecognizedContract(address string) bool {
+	if _, ok := us.protocolByRouter(address); ok {
+		return true
+	}
+	for _, c := range us.RecognizedContracts {
+		if icaseCompare(c, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func (us UniswapSummaryRequest) isLiquidityProviderToken(symbol string) bool {
+	_, ok := us.protocolBySymbol(symbol)
+	return ok
+}
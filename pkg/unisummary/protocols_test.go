@@ -0,0 +1,55 @@
+package unisummary
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsRecognizedContract(t *testing.T) {
+	const zapper = "0x0000000000000000000000000000000000000fff"
+	us := UniswapSummaryRequest{Protocols: DEFAULT_PROTOCOLS, RecognizedContracts: []string{zapper}}
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{UNISWAP_CONTRACT_ADDRESS, true},
+		{UNISWAP_ROUTER01_ADDRESS, true},
+		{SUSHISWAP_ROUTER_ADDRESS, true},
+		{"0x0000000000000000000000000000000000000FFF", true},
+		{testPair, false},
+	}
+	for _, test := range tests {
+		if got := us.isRecognizedContract(test.address); got != test.want {
+			t.Errorf("isRecognizedContract(%s) = %v, want %v", test.address, got, test.want)
+		}
+	}
+}
+
+// pairReaderStub reads no factory, as pairs of some forks do not expose it
+type pairReaderStub struct{}
+
+func (pairReaderStub) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	return "", "", nil
+}
+
+func (pairReaderStub) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return "", nil
+}
+
+func (pairReaderStub) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return "", nil
+}
+
+func TestGetProtocolWithoutFactory(t *testing.T) {
+	fork := Protocol{Name: "Fork", LiquidityProviderTokenSymbol: "FORK-LP"}
+	us := &UniswapSummaryRequest{Protocols: []Protocol{fork, UNISWAP_V2}}
+	reader := eventLogReader{pairReader: pairReaderStub{}, factories: map[string]string{}}
+
+	protocol, err := reader.getProtocol(context.Background(), us, Token{LIQUIDITY_PROVIDER_TOKEN_SYMBOL, testPair, 18})
+	if err != nil || protocol.Name != UNISWAP_V2.Name {
+		t.Errorf("getProtocol = %q, %v, want %q", protocol.Name, err, UNISWAP_V2.Name)
+	}
+	if _, ok := us.protocolByFactory(""); ok {
+		t.Errorf("protocolByFactory(\"\") matched a protocol without factory")
+	}
+}
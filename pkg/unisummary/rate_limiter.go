@@ -0,0 +1,122 @@
+package unisummary
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Etherscan free tier limit
+const ETHERSCAN_REQUESTS_PER_SECOND = 5
+
+const RETRY_MAX_ATTEMPTS = 5
+const RETRY_BASE_DELAY = 250 * time.Millisecond
+
+// Pause after Etherscan reports the rate limit was reached, letting its
+// one second window reset
+const RATE_LIMIT_PAUSE = time.Second
+
+// RateLimiter is a token bucket shared by every request made with the
+// same API key. Requests wait for a token before being sent
+type RateLimiter struct {
+	mutex       sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+var rateLimitersMutex sync.Mutex
+var rateLimiters = map[string]*RateLimiter{}
+
+// EtherscanRateLimiter returns the limiter of an API key, so that every
+// data source using the key shares its limit
+func EtherscanRateLimiter(key string) *RateLimiter {
+	rateLimitersMutex.Lock()
+	defer rateLimitersMutex.Unlock()
+	if rateLimiters[key] == nil {
+		rateLimiters[key] = NewRateLimiter(ETHERSCAN_REQUESTS_PER_SECOND, ETHERSCAN_REQUESTS_PER_SECOND)
+	}
+	return rateLimiters[key]
+}
+
+// Wait takes a token, sleeping until one is available
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Tokens go negative when reserved ahead, so waiters queue in order
+	l.tokens--
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if paused := l.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+	l.mutex.Unlock()
+	if err := sleep(ctx, wait); err != nil {
+		return err
+	}
+	// A Pause made while sleeping holds the waiter too
+	for {
+		l.mutex.Lock()
+		paused := time.Until(l.pausedUntil)
+		l.mutex.Unlock()
+		if paused <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, paused); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause holds every request for a while and empties the bucket
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	if l.tokens > 0 {
+		l.tokens = 0
+	}
+}
+
+// retryDelay is an exponential backoff with jitter, so that requests
+// failing together do not retry together
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	backoff := float64(base) * math.Pow(2.0, float64(attempts))
+	return time.Duration(backoff/2 + rand.Float64()*backoff/2)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	log(fmt.Sprintf("Sleeping for %0.2f milliseconds ", float64(d)/1e6))
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package unisummary
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitAll starts count waiters together and returns when each got through
+func waitAll(ctx context.Context, limiter *RateLimiter, count int) ([]time.Duration, []error) {
+	start := time.Now()
+	elapsed := make([]time.Duration, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = limiter.Wait(ctx)
+			elapsed[i] = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+	sort.Slice(elapsed, func(i, j int) bool { return elapsed[i] < elapsed[j] })
+	return elapsed, errs
+}
+
+func TestRateLimiterSpacing(t *testing.T) {
+	const interval = 40 * time.Millisecond
+	limiter := NewRateLimiter(float64(time.Second/interval), 1)
+	elapsed, _ := waitAll(context.Background(), limiter, 5)
+	if elapsed[0] > interval/2 {
+		t.Errorf("first waiter took %v, want no wait", elapsed[0])
+	}
+	for i := 1; i < len(elapsed); i++ {
+		if gap := elapsed[i] - elapsed[i-1]; gap < interval*3/4 {
+			t.Errorf("waiters %d and %d %v apart, want about %v", i-1, i, gap, interval)
+		}
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	const pause = 100 * time.Millisecond
+	limiter := NewRateLimiter(1000, 10)
+	limiter.Pause(pause)
+	elapsed, _ := waitAll(context.Background(), limiter, 3)
+	if elapsed[0] < pause*9/10 {
+		t.Errorf("waiter got through after %v during a %v pause", elapsed[0], pause)
+	}
+
+	// Waiters already sleeping for a token are held as well
+	limiter = NewRateLimiter(20, 1)
+	limiter.Wait(context.Background())
+	start := time.Now()
+	done := make(chan time.Duration)
+	go func() {
+		limiter.Wait(context.Background())
+		done <- time.Since(start)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	limiter.Pause(3 * pause)
+	if waited := <-done; waited < 3*pause {
+		t.Errorf("sleeping waiter got through after %v during a %v pause", waited, 3*pause)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := NewRateLimiter(0.1, 1)
+	limiter.Wait(context.Background())
+	for _, hold := range []func(){func() {}, func() { limiter.Pause(time.Minute) }} {
+		hold()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		elapsed, errs := waitAll(ctx, limiter, 2)
+		cancel()
+		if elapsed[1] > time.Second || !errors.Is(errs[0], context.DeadlineExceeded) || !errors.Is(errs[1], context.DeadlineExceeded) {
+			t.Errorf("cancelled waiters returned %v after %v", errs, elapsed)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sleep(ctx, retryDelay(time.Minute, 0)); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Errorf("cancelled retry backoff returned %v after %v", err, time.Since(start))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	const base = 100 * time.Millisecond
+	for attempts := 0; attempts < 5; attempts++ {
+		backoff := base << uint(attempts)
+		delays := map[time.Duration]bool{}
+		for i := 0; i < 50; i++ {
+			delay := retryDelay(base, attempts)
+			if delay < backoff/2 || delay > backoff {
+				t.Errorf("retryDelay(%v, %d) = %v, want between %v and %v", base, attempts, delay, backoff/2, backoff)
+			}
+			delays[delay] = true
+		}
+		if len(delays) < 2 {
+			t.Errorf("retryDelay(%v, %d) has no jitter", base, attempts)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package unisummary
+
+import (
+	"math"
+	"math/big"
+	"time"
+)
+
+const XIRR_MAX_ITERATIONS = 200
+const XIRR_TOLERANCE = 1e-9
+
+// CashFlow is money put in (negative) or taken out (positive) of a
+// position, in token1
+type CashFlow struct {
+	Date   time.Time
+	Amount float64
+}
+
+// withCashFlowReturns sets the returns that account for every deposit and
+// withdrawal of the position. Each event is valued in token1 at the pool
+// price implied by its quantities; finalValue is what is still held at end
+func withCashFlowReturns(response UniswapSummaryResponse, finalValue *big.Rat, end time.Time) UniswapSummaryResponse {
+	events := response.Token.Events
+	if len(events) == 0 {
+		return response
+	}
+	var flows []CashFlow
+	twr := 1.0
+	held := new(big.Rat)
+	lastValue := 0.0
+	for _, e := range events {
+		value := eventValue(e)
+		if e.PairQuantity.IsZero() {
+			continue
+		}
+		valuePerLp := new(big.Rat).Quo(value, e.PairQuantity.Rat())
+		before := ratFloat64(new(big.Rat).Mul(held, valuePerLp))
+		if lastValue > 0 {
+			twr *= before / lastValue
+		}
+		if e.Type == AddLiquidity {
+			held.Add(held, e.PairQuantity.Rat())
+			flows = append(flows, CashFlow{e.Date, -ratFloat64(value)})
+		} else {
+			held.Sub(held, e.PairQuantity.Rat())
+			if held.Sign() < 0 {
+				held.SetInt64(0)
+			}
+			flows = append(flows, CashFlow{e.Date, ratFloat64(value)})
+		}
+		lastValue = ratFloat64(new(big.Rat).Mul(held, valuePerLp))
+	}
+	if lastValue > 0 {
+		twr *= ratFloat64(finalValue) / lastValue
+	}
+	if finalValue.Sign() != 0 {
+		flows = append(flows, CashFlow{end, ratFloat64(finalValue)})
+	}
+	response.CashFlows = flows
+	response.TimeWeightedReturn = (twr - 1.0) * 100.0
+	if xirr, ok := Xirr(flows); ok {
+		response.Xirr = xirr * 100.0
+		response.HasXirr = true
+	}
+	return response
+}
+
+// eventValue is twice the token1 quantity: at the price implied by the
+// quantities, the token2 side is worth as much as the token1 side
+func eventValue(e LiquidityEvent) *big.Rat {
+	value := e.Token1Quantity.Rat()
+	return value.Add(value, value)
+}
+
+// Xirr is the annual rate that brings the net present value of the flows
+// to zero. There is none with fewer than two flows or when they all have
+// the same sign
+func Xirr(flows []CashFlow) (float64, bool) {
+	if len(flows) < 2 {
+		return 0, false
+	}
+	start := flows[0].Date
+	for _, f := range flows {
+		if f.Date.Before(start) {
+			start = f.Date
+		}
+	}
+	npv := func(rate float64) float64 {
+		sum := 0.0
+		for _, f := range flows {
+			sum += f.Amount / math.Pow(1.0+rate, daysBetween(start, f.Date)/365.0)
+		}
+		return sum
+	}
+
+	// Bisection over a bracket of rates, which converges for any sign
+	// pattern of the flows as long as the npv changes sign
+	low, high := -0.999999, 1.0
+	for npv(high) > 0 && high < 1e6 {
+		high *= 2
+	}
+	if npv(low)*npv(high) > 0 {
+		return 0, false
+	}
+	for i := 0; i < XIRR_MAX_ITERATIONS; i++ {
+		mid := (low + high) / 2
+		value := npv(mid)
+		if math.Abs(value) < XIRR_TOLERANCE || (high-low)/2 < XIRR_TOLERANCE {
+			return mid, true
+		}
+		if value*npv(low) > 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, true
+}
@@ -0,0 +1,61 @@
+package unisummary
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestEventValue(t *testing.T) {
+	e := LiquidityEvent{
+		Token1Quantity: NewTokenAmount(big.NewInt(1500), 0),
+		Token2Quantity: NewTokenAmount(big.NewInt(1), 0),
+	}
+	if value := eventValue(e); value.Cmp(big.NewRat(3000, 1)) != 0 {
+		t.Errorf("eventValue = %s, want 3000", value.RatString())
+	}
+	if e.Token1Quantity.String() != "1500" {
+		t.Errorf("eventValue modified the event quantity to %s", e.Token1Quantity)
+	}
+}
+
+func TestXirr(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	yearLater := start.AddDate(0, 0, 365)
+	tests := []struct {
+		name  string
+		flows []CashFlow
+		want  float64
+		ok    bool
+	}{
+		{"no flows", nil, 0, false},
+		{"single flow", []CashFlow{{start, -100}}, 0, false},
+		{"no sign change", []CashFlow{{start, -100}, {yearLater, -10}}, 0, false},
+		{"ten percent", []CashFlow{{start, -100}, {yearLater, 110}}, 0.1, true},
+	}
+	for _, test := range tests {
+		got, ok := Xirr(test.flows)
+		if ok != test.ok || math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%s: Xirr = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestWithCashFlowReturnsWithoutXirr(t *testing.T) {
+	response := UniswapSummaryResponse{Token: LiquidityProviderPosition{Events: []LiquidityEvent{{
+		Type:           AddLiquidity,
+		Date:           time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		PairQuantity:   NewTokenAmount(big.NewInt(10), 0),
+		Token1Quantity: NewTokenAmount(big.NewInt(100), 0),
+		Token2Quantity: NewTokenAmount(big.NewInt(1), 0),
+	}}}}
+	response = withCashFlowReturns(response, new(big.Rat), time.Now())
+	if response.HasXirr || response.Xirr != 0 {
+		t.Errorf("Xirr = %v, HasXirr = %v, want none", response.Xirr, response.HasXirr)
+	}
+	if _, err := json.Marshal(response); err != nil {
+		t.Errorf("json.Marshal: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package unisummary
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const SELECTOR_EARNED = "0x008cc262"
+const SELECTOR_USER_INFO = "0x93f1a40b"
+const SELECTOR_PENDING_SUSHI = "0x195426ec"
+const SELECTOR_MASTER_CHEF_DEPOSIT = "0xe2bbb158"
+
+var TOKEN_UNI = Token{"UNI", "0x1f9840a85d5af5bf1d1762f925bdaddc4201f984", 18}
+var TOKEN_SUSHI = Token{"SUSHI", "0x6b3595068778dd592e39a122f4f5a5cf09c90fe2", 18}
+
+type StakingKind string
+
+// StakingRewards contracts hold the LP token of a single pair, while
+// MasterChef contracts hold many pairs, each in its own pool
+var StakingRewards = StakingKind("StakingRewards")
+var MasterChef = StakingKind("MasterChef")
+
+type StakingContract struct {
+	Name    string
+	Kind    StakingKind
+	Address string
+	// Pair staked in a StakingRewards contract
+	Pair string
+	// Pool of the pair in a MasterChef contract, found from the deposit
+	// transactions
+	PoolId      int
+	RewardToken Token
+}
+
+var UNISWAP_STAKING_ETH_USDT = StakingContract{"UNI ETH/USDT", StakingRewards, "0x6c3e4cb2e96b01f4b866965a91ed4437839a121a", "0x0d4a11d5eeaac28ec3f61d100daf4d40471f1852", 0, TOKEN_UNI}
+var UNISWAP_STAKING_ETH_USDC = StakingContract{"UNI ETH/USDC", StakingRewards, "0x7fba4b8dc5e7616e59622806932dbea72537a56b", "0xb4e16d0168e52d35cacd2c6185b44281ec28c9dc", 0, TOKEN_UNI}
+var UNISWAP_STAKING_ETH_DAI = StakingContract{"UNI ETH/DAI", StakingRewards, "0xa1484c3aa22a66c62b77e0ae78e15258bd0cb711", "0xa478c2975ab1ea89e8196811f51a7b7ade33eb11", 0, TOKEN_UNI}
+var UNISWAP_STAKING_ETH_WBTC = StakingContract{"UNI ETH/WBTC", StakingRewards, "0xca35e32e7926b96a9988f61d510e038108d8068e", "0xbb2b8038a1640196fbe3e38816f3e67cba72d940", 0, TOKEN_UNI}
+var SUSHISWAP_MASTER_CHEF = StakingContract{"SushiSwap MasterChef", MasterChef, "0xc2edad668740f1aa35e4d8f227fb8e17dca888cd", "", 0, TOKEN_SUSHI}
+
+var DEFAULT_STAKING_CONTRACTS = []StakingContract{
+	UNISWAP_STAKING_ETH_USDT,
+	UNISWAP_STAKING_ETH_USDC,
+	UNISWAP_STAKING_ETH_DAI,
+	UNISWAP_STAKING_ETH_WBTC,
+	SUSHISWAP_MASTER_CHEF,
+}
+
+// Reward is income from a staking contract, not yet claimed
+type Reward struct {
+	Contract StakingContract
+	Quantity TokenAmount
+}
+
+func (us UniswapSummaryRequest) stakingContract(address string) (StakingContract, bool) {
+	for _, c := range us.StakingContracts {
+		if icaseCompare(c.Address, address) {
+			return c, true
+		}
+	}
+	return StakingContract{}, false
+}
+
+// withStakingContracts records on each position the staking contracts its
+// LP tokens were sent to, so the staked balance and rewards can be queried.
+// MasterChef deposits made through another contract, such as a zapper or
+// a smart contract wallet, carry no pool id and are skipped
+func withStakingContracts(us *UniswapSummaryRequest, positions []LiquidityProviderPosition, normalTransactions EtherscanNormalTransactionsResponse, tokenTransactions EtherscanTokenTransactionsResponse) []LiquidityProviderPosition {
+	for _, tt := range tokenTransactions.Result {
+		if !us.isOwnAddress(tt.From) {
+			continue
+		}
+		contract, ok := us.stakingContract(tt.To)
+		if !ok {
+			continue
+		}
+		if contract.Kind == MasterChef {
+			poolId, ok := masterChefPoolId(normalTransactions, tt.Hash)
+			if !ok {
+				log(fmt.Sprintf("Skipping MasterChef transfer %s without a deposit call", tt.Hash))
+				continue
+			}
+			contract.PoolId = poolId
+		} else if !icaseCompare(contract.Pair, tt.ContractAddress) {
+			continue
+		}
+		for i, p := range positions {
+			if icaseCompare(p.Pair.Address, tt.ContractAddress) && !p.isStakedIn(contract) {
+				positions[i].Staking = append(positions[i].Staking, contract)
+			}
+		}
+	}
+	return positions
+}
+
+func masterChefPoolId(normalTransactions EtherscanNormalTransactionsResponse, hash string) (int, bool) {
+	for _, t := range normalTransactions.Result {
+		if t.Hash == hash && strings.HasPrefix(t.Input, SELECTOR_MASTER_CHEF_DEPOSIT) {
+			poolId, err := decodeUint("0x"+strings.TrimPrefix(t.Input, SELECTOR_MASTER_CHEF_DEPOSIT), 0)
+			if err != nil || !poolId.IsInt64() {
+				return 0, false
+			}
+			return int(poolId.Int64()), true
+		}
+	}
+	return 0, false
+}
+
+func (p LiquidityProviderPosition) isStakedIn(contract StakingContract) bool {
+	for _, c := range p.Staking {
+		if icaseCompare(c.Address, contract.Address) && c.PoolId == contract.PoolId {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchStaked returns the LP tokens the wallet has staked in the contract
+// and the pending rewards
+func (us UniswapSummaryRequest) fetchStaked(ctx context.Context, thisT LiquidityProviderPosition, contract StakingContract, walletAddress string) (TokenAmount, Reward, error) {
+	caller, ok := us.DataSource.(ContractCaller)
+	if !ok {
+		return TokenAmount{}, Reward{}, fmt.Errorf("%w: staked balances require contract calls", ErrNotSupported)
+	}
+	var staked, earned string
+	var err error
+	if contract.Kind == MasterChef {
+		poolId := encodeUint(big.NewInt(int64(contract.PoolId)))
+		staked, err = callUint(ctx, caller, contract.Address, encodeCall(SELECTOR_USER_INFO, poolId, encodeAddress(walletAddress)))
+		if err != nil {
+			return TokenAmount{}, Reward{}, err
+		}
+		earned, err = callUint(ctx, caller, contract.Address, encodeCall(SELECTOR_PENDING_SUSHI, poolId, encodeAddress(walletAddress)))
+	} else {
+		staked, err = callBalanceOf(ctx, caller, contract.Address, walletAddress)
+		if err != nil {
+			return TokenAmount{}, Reward{}, err
+		}
+		earned, err = callUint(ctx, caller, contract.Address, encodeCall(SELECTOR_EARNED, encodeAddress(walletAddress)))
+	}
+	if err != nil {
+		return TokenAmount{}, Reward{}, err
+	}
+	stakedAmount, err := ParseTokenAmount(staked, thisT.Pair.Decimals)
+	if err != nil {
+		return TokenAmount{}, Reward{}, err
+	}
+	earnedAmount, err := ParseTokenAmount(earned, contract.RewardToken.Decimals)
+	if err != nil {
+		return TokenAmount{}, Reward{}, err
+	}
+	return stakedAmount, Reward{contract, earnedAmount}, nil
+}
+
+// stakingContractsFor adds the registered StakingRewards contracts of the
+// pair, which can be queried without knowing the staking history
+func (us UniswapSummaryRequest) stakingContractsFor(thisT LiquidityProviderPosition) []StakingContract {
+	contracts := append([]StakingContract{}, thisT.Staking...)
+	if _, ok := us.DataSource.(ContractCaller); !ok {
+		return contracts
+	}
+	for _, c := range us.StakingContracts {
+		if c.Kind == StakingRewards && icaseCompare(c.Pair, thisT.Pair.Address) && !thisT.isStakedIn(c) {
+			contracts = append(contracts, c)
+		}
+	}
+	return contracts
+}
@@ -0,0 +1,32 @@
+package unisummary
+
+import (
+	"testing"
+)
+
+func TestWithStakingContractsMasterChef(t *testing.T) {
+	us := &UniswapSummaryRequest{UserAddress: testWallet, StakingContracts: DEFAULT_STAKING_CONTRACTS}
+	positions := []LiquidityProviderPosition{{Pair: Token{"LP", testPair, 18}}}
+	deposit := EtherscanNormalTransaction{Hash: "0x01", Input: SELECTOR_MASTER_CHEF_DEPOSIT + leftPad("c") + leftPad("64")}
+	zap := EtherscanNormalTransaction{Hash: "0x02", Input: "0x12345678"}
+	normal := EtherscanNormalTransactionsResponse{Result: []EtherscanNormalTransaction{deposit, zap}}
+
+	tests := []struct {
+		name    string
+		hash    string
+		staking []StakingContract
+	}{
+		{"deposit call", deposit.Hash, []StakingContract{{"SushiSwap MasterChef", MasterChef, SUSHISWAP_MASTER_CHEF.Address, "", 12, TOKEN_SUSHI}}},
+		{"deposit through another contract", zap.Hash, nil},
+		{"transaction not in the history", "0x03", nil},
+	}
+	for _, test := range tests {
+		tokens := EtherscanTokenTransactionsResponse{Result: []EtherscanTokenTransaction{
+			{Hash: test.hash, From: testWallet, To: SUSHISWAP_MASTER_CHEF.Address, ContractAddress: testPair},
+		}}
+		got := withStakingContracts(us, append([]LiquidityProviderPosition{}, positions...), normal, tokens)
+		if len(got) != 1 || len(got[0].Staking) != len(test.staking) || (len(test.staking) > 0 && got[0].Staking[0] != test.staking[0]) {
+			t.Errorf("%s: staking = %+v, want %+v", test.name, got[0].Staking, test.staking)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Blocks whose transactions are requested again on every sync, in case
+// the chain reorganized them away
+const DEFAULT_CONFIRMATIONS = 12
+
+// TransactionStore keeps the fetched wallet histories in a JSON file
+type TransactionStore struct {
+	Path    string
+	mutex   sync.Mutex
+	wallets map[string]*storedWallet
+}
+
+type storedWallet struct {
+	Normal       []EtherscanNormalTransaction
+	Token        []EtherscanTokenTransaction
+	Internal     []EtherscanInternalTransaction
+	NormalSync   syncState
+	TokenSync    syncState
+	InternalSync syncState
+}
+
+// syncState is the last block of a synced history
+type syncState struct {
+	Synced bool
+	Block  uint64
+}
+
+func (s syncState) startBlock(confirmations uint64) uint64 {
+	if !s.Synced || s.Block < confirmations {
+		return 0
+	}
+	return s.Block - confirmations
+}
+
+// OpenTransactionStore loads the store file, which is created on the
+// first sync if missing
+func OpenTransactionStore(path string) (*TransactionStore, error) {
+	store := &TransactionStore{Path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.wallets); err != nil {
+		return nil, malformed("transaction store %s: %s", path, err)
+	}
+	return store, nil
+}
+
+func (s *TransactionStore) wallet(address string) *storedWallet {
+	if s.wallets == nil {
+		s.wallets = map[string]*storedWallet{}
+	}
+	key := strings.ToLower(address)
+	if s.wallets[key] == nil {
+		s.wallets[key] = &storedWallet{}
+	}
+	return s.wallets[key]
+}
+
+// save writes a temporary file first, so an interrupted run leaves the
+// previous store intact
+func (s *TransactionStore) save() error {
+	data, err := json.Marshal(s.wallets)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.Path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.Path+".tmp", s.Path)
+}
+
+// StoredDataSource serves wallet histories from a TransactionStore,
+// requesting only the blocks after the last synced one (minus the
+// confirmations). Other calls go straight to the wrapped source
+type StoredDataSource struct {
+	Source        ChainDataSource
+	Store         *TransactionStore
+	Confirmations uint64
+}
+
+func NewStoredDataSource(source ChainDataSource, path string) (StoredDataSource, error) {
+	store, err := OpenTransactionStore(path)
+	if err != nil {
+		return StoredDataSource{}, err
+	}
+	return StoredDataSource{Source: source, Store: store, Confirmations: DEFAULT_CONFIRMATIONS}, nil
+}
+
+func (s StoredDataSource) GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error) {
+	s.Store.mutex.Lock()
+	defer s.Store.mutex.Unlock()
+	w := s.Store.wallet(walletAddress)
+	start := w.NormalSync.startBlock(s.Confirmations)
+	var fresh EtherscanNormalTransactionsResponse
+	err := ErrNotSupported
+	if rangeSource, ok := s.Source.(TransactionRangeSource); ok && start > 0 {
+		fresh, err = rangeSource.GetNormalTransactionsFrom(ctx, walletAddress, start)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		start = 0
+		fresh, err = s.Source.GetNormalTransactions(ctx, walletAddress)
+	}
+	if err != nil {
+		return EtherscanNormalTransactionsResponse{}, err
+	}
+	rows := []EtherscanNormalTransaction{}
+	for _, t := range w.Normal {
+		if block, _ := toInt(t.BlockNumber); uint64(block) < start {
+			rows = append(rows, t)
+		}
+	}
+	rows = append(rows, fresh.Result...)
+	blocks := []string{}
+	for _, t := range rows {
+		blocks = append(blocks, t.BlockNumber)
+	}
+	state, err := syncedState(blocks)
+	if err != nil {
+		return EtherscanNormalTransactionsResponse{}, err
+	}
+	w.Normal, w.NormalSync = rows, state
+	fresh.Result = append([]EtherscanNormalTransaction{}, rows...)
+	return fresh, s.Store.save()
+}
+
+func (s StoredDataSource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	s.Store.mutex.Lock()
+	defer s.Store.mutex.Unlock()
+	w := s.Store.wallet(walletAddress)
+	start := w.TokenSync.startBlock(s.Confirmations)
+	var fresh EtherscanTokenTransactionsResponse
+	err := ErrNotSupported
+	if rangeSource, ok := s.Source.(TransactionRangeSource); ok && start > 0 {
+		fresh, err = rangeSource.GetTokenTransactionsFrom(ctx, walletAddress, start)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		start = 0
+		fresh, err = s.Source.GetTokenTransactions(ctx, walletAddress)
+	}
+	if err != nil {
+		return EtherscanTokenTransactionsResponse{}, err
+	}
+	rows := []EtherscanTokenTransaction{}
+	for _, t := range w.Token {
+		if block, _ := toInt(t.BlockNumber); uint64(block) < start {
+			rows = append(rows, t)
+		}
+	}
+	rows = append(rows, fresh.Result...)
+	blocks := []string{}
+	for _, t := range rows {
+		blocks = append(blocks, t.BlockNumber)
+	}
+	state, err := syncedState(blocks)
+	if err != nil {
+		return EtherscanTokenTransactionsResponse{}, err
+	}
+	w.Token, w.TokenSync = rows, state
+	fresh.Result = append([]EtherscanTokenTransaction{}, rows...)
+	return fresh, s.Store.save()
+}
+
+func (s StoredDataSource) GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error) {
+	s.Store.mutex.Lock()
+	defer s.Store.mutex.Unlock()
+	w := s.Store.wallet(walletAddress)
+	start := w.InternalSync.startBlock(s.Confirmations)
+	var fresh EtherscanInternalTransactionsResponse
+	err := ErrNotSupported
+	if rangeSource, ok := s.Source.(TransactionRangeSource); ok && start > 0 {
+		fresh, err = rangeSource.GetInternalTransactionsFrom(ctx, walletAddress, start)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		start = 0
+		fresh, err = s.Source.GetInternalTransactions(ctx, walletAddress)
+	}
+	if err != nil {
+		return EtherscanInternalTransactionsResponse{}, err
+	}
+	rows := []EtherscanInternalTransaction{}
+	for _, t := range w.Internal {
+		if block, _ := toInt(t.BlockNumber); uint64(block) < start {
+			rows = append(rows, t)
+		}
+	}
+	rows = append(rows, fresh.Result...)
+	blocks := []string{}
+	for _, t := range rows {
+		blocks = append(blocks, t.BlockNumber)
+	}
+	state, err := syncedState(blocks)
+	if err != nil {
+		return EtherscanInternalTransactionsResponse{}, err
+	}
+	w.Internal, w.InternalSync = rows, state
+	fresh.Result = append([]EtherscanInternalTransaction{}, rows...)
+	return fresh, s.Store.save()
+}
+
+func syncedState(blocks []string) (syncState, error) {
+	state := syncState{Synced: true}
+	for _, b := range blocks {
+		block, err := toInt(b)
+		if err != nil {
+			return syncState{}, err
+		}
+		if uint64(block) > state.Block {
+			state.Block = uint64(block)
+		}
+	}
+	return state, nil
+}
+
+func (s StoredDataSource) GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error) {
+	return s.Source.GetBalance(ctx, tokenAddress, walletAddress)
+}
+
+func (s StoredDataSource) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	return s.Source.GetSupply(ctx, tokenAddress)
+}
+
+func (s StoredDataSource) Call(ctx context.Context, to string, data string) (string, error) {
+	return forwardCall(ctx, s.Source, to, data)
+}
+
+func (s StoredDataSource) CallAtBlock(ctx context.Context, to string, data string, block uint64) (string, error) {
+	return forwardCallAtBlock(ctx, s.Source, to, data, block)
+}
+
+func (s StoredDataSource) GetReserves(ctx context.Context, pairAddress string) (string, string, error) {
+	return forwardGetReserves(ctx, s.Source, pairAddress)
+}
+
+func (s StoredDataSource) GetToken0(ctx context.Context, pairAddress string) (string, error) {
+	return forwardGetToken0(ctx, s.Source, pairAddress)
+}
+
+func (s StoredDataSource) GetToken1(ctx context.Context, pairAddress string) (string, error) {
+	return forwardGetToken1(ctx, s.Source, pairAddress)
+}
+
+func (s StoredDataSource) GetLogs(ctx context.Context, query LogQuery) ([]Log, error) {
+	return forwardGetLogs(ctx, s.Source, query)
+}
@@ -0,0 +1,110 @@
+package unisummary
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// rangeSource serves a token history that tests change between syncs,
+// recording the block each request starts from
+type rangeSource struct {
+	transactionsOnlySource
+	rows   *[]EtherscanTokenTransaction
+	starts *[]uint64
+}
+
+func (s rangeSource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	return s.GetTokenTransactionsFrom(ctx, walletAddress, 0)
+}
+
+func (s rangeSource) GetTokenTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanTokenTransactionsResponse, error) {
+	*s.starts = append(*s.starts, startBlock)
+	response := EtherscanTokenTransactionsResponse{Result: []EtherscanTokenTransaction{}}
+	for _, t := range *s.rows {
+		if block, _ := strconv.Atoi(t.BlockNumber); uint64(block) >= startBlock {
+			response.Result = append(response.Result, t)
+		}
+	}
+	return response, nil
+}
+
+func (s rangeSource) GetNormalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanNormalTransactionsResponse, error) {
+	return EtherscanNormalTransactionsResponse{}, nil
+}
+
+func (s rangeSource) GetInternalTransactionsFrom(ctx context.Context, walletAddress string, startBlock uint64) (EtherscanInternalTransactionsResponse, error) {
+	return EtherscanInternalTransactionsResponse{}, nil
+}
+
+func TestStoredDataSourceResync(t *testing.T) {
+	row := func(hash string, block int) EtherscanTokenTransaction {
+		return EtherscanTokenTransaction{Hash: hash, BlockNumber: strconv.Itoa(block)}
+	}
+	tests := []struct {
+		name string
+		// History at the first and at the second sync
+		before, after []EtherscanTokenTransaction
+		// Blocks requested by the second sync, and the hashes it returns
+		starts []uint64
+		hashes []string
+	}{
+		{"new rows",
+			[]EtherscanTokenTransaction{row("a", 10), row("b", 95), row("c", 100)},
+			[]EtherscanTokenTransaction{row("a", 10), row("b", 95), row("c", 100), row("d", 150)},
+			[]uint64{100 - DEFAULT_CONFIRMATIONS}, []string{"a", "b", "c", "d"}},
+		{"reorganized rows within the confirmations",
+			[]EtherscanTokenTransaction{row("a", 10), row("b", 95), row("c", 100)},
+			[]EtherscanTokenTransaction{row("a", 10), row("c2", 101)},
+			[]uint64{100 - DEFAULT_CONFIRMATIONS}, []string{"a", "c2"}},
+		{"row at the first re-requested block",
+			[]EtherscanTokenTransaction{row("a", 10), row("b", 100-DEFAULT_CONFIRMATIONS), row("c", 100)},
+			[]EtherscanTokenTransaction{row("a", 10), row("b", 100-DEFAULT_CONFIRMATIONS), row("c", 100)},
+			[]uint64{100 - DEFAULT_CONFIRMATIONS}, []string{"a", "b", "c"}},
+		{"history shorter than the confirmations",
+			[]EtherscanTokenTransaction{row("a", 5)},
+			[]EtherscanTokenTransaction{row("a", 5), row("b", 6)},
+			[]uint64{0}, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "unisummary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "store.json")
+		rows := test.before
+		starts := []uint64{}
+		source := rangeSource{rows: &rows, starts: &starts}
+
+		stored, err := NewStoredDataSource(source, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stored.GetTokenTransactions(context.Background(), testWallet); err != nil {
+			t.Fatalf("%s: first sync: %v", test.name, err)
+		}
+
+		// A later run reopens the store file
+		rows, starts = test.after, []uint64{}
+		stored, err = NewStoredDataSource(source, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := stored.GetTokenTransactions(context.Background(), testWallet)
+		if err != nil {
+			t.Fatalf("%s: second sync: %v", test.name, err)
+		}
+		hashes := []string{}
+		for _, tt := range response.Result {
+			hashes = append(hashes, tt.Hash)
+		}
+		if !reflect.DeepEqual(starts, test.starts) || !reflect.DeepEqual(hashes, test.hashes) {
+			t.Errorf("%s: requested from %v and got %v, want %v and %v", test.name, starts, hashes, test.starts, test.hashes)
+		}
+	}
+}
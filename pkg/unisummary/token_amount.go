@@ -0,0 +1,145 @@
+package unisummary
+
+import (
+	"math/big"
+	"strings"
+)
+
+// TokenAmount is an exact token quantity in raw units (e.g. wei) along
+// with the decimals needed to display it
+type TokenAmount struct {
+	Raw      *big.Int
+	Decimals int
+}
+
+func NewTokenAmount(raw *big.Int, decimals int) TokenAmount {
+	return TokenAmount{Raw: raw, Decimals: decimals}
+}
+
+func ParseTokenAmount(raw string, decimals int) (TokenAmount, error) {
+	value, err := toBigInt(raw)
+	if err != nil {
+		return TokenAmount{}, err
+	}
+	return NewTokenAmount(value, decimals), nil
+}
+
+// TokenAmountFromRat converts a quantity in token units, truncating
+// anything below the smallest raw unit
+func TokenAmountFromRat(quantity *big.Rat, decimals int) TokenAmount {
+	scaled := new(big.Rat).Mul(quantity, new(big.Rat).SetInt(pow10(decimals)))
+	raw := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	return NewTokenAmount(raw, decimals)
+}
+
+func (a TokenAmount) raw() *big.Int {
+	if a.Raw == nil {
+		return new(big.Int)
+	}
+	return a.Raw
+}
+
+func (a TokenAmount) IsZero() bool {
+	return a.raw().Sign() == 0
+}
+
+func (a TokenAmount) Sign() int {
+	return a.raw().Sign()
+}
+
+func (a TokenAmount) Neg() TokenAmount {
+	return NewTokenAmount(new(big.Int).Neg(a.raw()), a.Decimals)
+}
+
+func (a TokenAmount) Add(b TokenAmount) TokenAmount {
+	decimals := a.Decimals
+	if b.Decimals > decimals {
+		decimals = b.Decimals
+	}
+	return TokenAmountFromRat(new(big.Rat).Add(a.Rat(), b.Rat()), decimals)
+}
+
+func (a TokenAmount) Sub(b TokenAmount) TokenAmount {
+	return a.Add(b.Neg())
+}
+
+// Rat returns the quantity in token units
+func (a TokenAmount) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(a.raw(), pow10(a.Decimals))
+}
+
+func (a TokenAmount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+func (a TokenAmount) String() string {
+	text := a.decimalText()
+	if a.Decimals > 0 {
+		text = strings.TrimSuffix(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
+
+// decimalText formats the quantity with every decimal digit
+func (a TokenAmount) decimalText() string {
+	digits := new(big.Int).Abs(a.raw()).String()
+	if a.Decimals > 0 {
+		if len(digits) <= a.Decimals {
+			digits = strings.Repeat("0", a.Decimals-len(digits)+1) + digits
+		}
+		point := len(digits) - a.Decimals
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if a.raw().Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Amounts are encoded as plain JSON numbers with full precision, keeping
+// every decimal digit so that decoding restores the decimals
+func (a TokenAmount) MarshalJSON() ([]byte, error) {
+	return []byte(a.decimalText()), nil
+}
+
+func (a *TokenAmount) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "null" {
+		return nil
+	}
+	decimals := 0
+	if point := strings.Index(text, "."); point >= 0 {
+		decimals = len(text) - point - 1
+		text = text[:point] + text[point+1:]
+	}
+	amount, err := ParseTokenAmount(text, decimals)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func toBigInt(str string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(str, 10)
+	if !ok {
+		return nil, malformed("invalid integer %q", str)
+	}
+	return value, nil
+}
+
+const BIG_FLOAT_PRECISION = 256
+
+func newBigFloat(r *big.Rat) *big.Float {
+	return new(big.Float).SetPrec(BIG_FLOAT_PRECISION).SetRat(r)
+}
+
+func ratFloat64(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
+}
@@ -0,0 +1,34 @@
+package unisummary
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestTokenAmountJsonRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount TokenAmount
+		json   string
+	}{
+		{"trailing zeros", NewTokenAmount(big.NewInt(15e17), 18), "1.500000000000000000"},
+		{"below one", NewTokenAmount(big.NewInt(-25), 3), "-0.025"},
+		{"whole", NewTokenAmount(big.NewInt(42), 0), "42"},
+		{"zero", NewTokenAmount(new(big.Int), 6), "0.000000"},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.amount)
+		if err != nil || string(data) != test.json {
+			t.Errorf("%s: json.Marshal = %s, %v, want %s", test.name, data, err, test.json)
+			continue
+		}
+		var decoded TokenAmount
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: json.Unmarshal: %v", test.name, err)
+		}
+		if decoded.Decimals != test.amount.Decimals || decoded.raw().Cmp(test.amount.raw()) != 0 {
+			t.Errorf("%s: decoded raw %s with %d decimals, want %s with %d", test.name, decoded.raw(), decoded.Decimals, test.amount.raw(), test.amount.Decimals)
+		}
+	}
+}
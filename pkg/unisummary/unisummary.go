@@ -1,35 +1,55 @@
 package unisummary
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 )
 
 type UniswapSummaryRequest struct {
-	EtherscanApiKey                       string
-	EtherscanSupplyEndpoint               string
-	EtherscanBalanceEndpoint              string
-	EtherscanNormalTransactionsEndpoint   string
-	EtherscanTokenTransactionsEndpoint    string
-	EtherscanInternalTransactionsEndpoint string
-	UserAddress                           string
-	LiquidityProviderTokens               []LiquidityProviderPosition
+	DataSource  ChainDataSource
+	UserAddress string
+	// Other wallets of the same owner. Positions are summarized across all
+	// of them and transfers among them keep the cost basis and date
+	UserAddresses           []string
+	LiquidityProviderTokens []LiquidityProviderPosition
+	V3Positions             []V3Position
+	// Order in which removals consume prior adds of the same pair
+	LotMatching LotMatching
+	// DEXes whose liquidity positions are looked for. Direct pair
+	// mint/burn calls are always recognized
+	Protocols []Protocol
+	// Other contracts whose transactions may add or remove liquidity, in
+	// addition to the routers of Protocols
+	RecognizedContracts []string
+	// Derive liquidity events from pair Mint/Burn logs when the data
+	// source supports it, instead of counting token transfers
+	DecodeEventLogs bool
+	// Liquidity mining contracts where LP tokens may be staked
+	StakingContracts []StakingContract
+	// Values responses in a quote currency when set
+	PriceOracle PriceOracle
+	// Positions summarized at the same time. Zero uses DEFAULT_CONCURRENCY
+	Concurrency int
+	// Called as each position is summarized, when set
+	Progress func(Progress)
 }
 
 func NewUniswapSummaryRequest(key string, userAddress string, lpTokens []LiquidityProviderPosition) *UniswapSummaryRequest {
 	return &UniswapSummaryRequest{
-		EtherscanApiKey:                       key,
-		EtherscanSupplyEndpoint:               ETHERSCAN_ENDPOINT_SUPPLY,
-		EtherscanBalanceEndpoint:              ETHERSCAN_ENDPOINT_BALANCE,
-		EtherscanNormalTransactionsEndpoint:   ETHERSCAN_WALLET_NORMAL_TRANSACTIONS,
-		EtherscanInternalTransactionsEndpoint: ETHERSCAN_WALLET_INTERNAL_TRANSACTIONS,
-		EtherscanTokenTransactionsEndpoint:    ETHERSCAN_WALLET_ERC20_TRANSACTIONS,
-		UserAddress:                           userAddress,
-		LiquidityProviderTokens:               lpTokens,
+		DataSource:              NewEtherscanDataSource(key),
+		UserAddress:             userAddress,
+		LiquidityProviderTokens: lpTokens,
+		LotMatching:             FIFO,
+		Protocols:               DEFAULT_PROTOCOLS,
+		DecodeEventLogs:         true,
+		StakingContracts:        DEFAULT_STAKING_CONTRACTS,
+		Concurrency:             DEFAULT_CONCURRENCY,
 	}
 }
 
@@ -43,105 +63,312 @@ type Token struct {
 }
 
 type LiquidityProviderPosition struct {
+	Protocol              string
 	Pair                  Token
-	PairQuantity          float64
+	PairQuantity          TokenAmount
 	Token1                Token
-	Token1InitialQuantity float64
+	Token1InitialQuantity TokenAmount
 	Token2                Token
-	Token2InitialQuantity float64
+	Token2InitialQuantity TokenAmount
 	InitialDate           time.Time
+	// Block of the InitialDate, when known
+	InitialBlock uint64
+	// ETH spent on gas to add liquidity for the open lots
+	GasCost    TokenAmount
+	Lots       []Lot
+	ClosedLots []ClosedLot
+	Events     []LiquidityEvent
+	// Contracts the LP tokens were staked in
+	Staking []StakingContract
 }
 
 type UniswapSummaryResponse struct {
 	Token               LiquidityProviderPosition
-	Balance             float64
-	Supply              float64
-	Liquidity1          float64
-	Liquidity2          float64
-	TotalK              float64
-	MyK                 float64
-	InitialK            float64
-	Token1FinalQuantity float64
-	Token2FinalQuantity float64
-	Token1Increase      float64
-	Token2Increase      float64
-	Token1Fee           float64
-	Token2Fee           float64
+	Balance             TokenAmount
+	Supply              TokenAmount
+	Liquidity1          TokenAmount
+	Liquidity2          TokenAmount
+	TotalK              *big.Float
+	MyK                 *big.Float
+	InitialK            *big.Float
+	Token1FinalQuantity TokenAmount
+	Token2FinalQuantity TokenAmount
+	Token1Increase      TokenAmount
+	Token2Increase      TokenAmount
+	Token1Fee           TokenAmount
+	Token2Fee           TokenAmount
 	RatioK              float64
 	PercentageFees      float64
-	InitialPrice        float64
-	FinalPrice          float64
+	InitialPrice        *big.Float
+	FinalPrice          *big.Float
 	DivergenceLoss      float64
 	AccruedProfit       float64
 	DaysEllapsed        float64
 	YearlyProfit        float64
+	GasCost             TokenAmount
+	// Profit after paying for gas. Gas is valued in the pair tokens when one
+	// of them is WETH, or else through the request PriceOracle. HasNetOfGas
+	// is false when gas cannot be valued, leaving these zero
+	AccruedProfitNetOfGas float64
+	YearlyProfitNetOfGas  float64
+	HasNetOfGas           bool
+	// Summary of each lot, with the position balance apportioned among
+	// lots by their share of the LP tokens
+	Lots []UniswapSummaryResponse
+	// Closed is set when every lot has been withdrawn. Realized holds the
+	// profit of each closed lot computed at withdrawal time
+	Closed   bool
+	Realized []UniswapSummaryResponse
+	// Pending staking rewards, income on top of the pool fees
+	Rewards []Reward
+	// Values in the quote currency of the request PriceOracle, at current
+	// prices. InitialValue is the initial quantities at current prices
+	InitialValue TokenAmount
+	CurrentValue TokenAmount
+	FeesValue    TokenAmount
+	ProfitValue  TokenAmount
+	RewardsValue TokenAmount
+	// Why the quote values are unset, e.g. a token without price route
+	QuoteError string
+	// Value of the deposits at the prices of the time they were made, set
+	// when the PriceOracle is a HistoricalPriceOracle. DepositReturn is the
+	// percentage return in the quote currency since then. DepositError is
+	// why they are unset, e.g. a node without the state of the deposit block
+	DepositValue       TokenAmount
+	DepositProfitValue TokenAmount
+	DepositReturn      float64
+	DepositError       string
+	// Value at the end date of holding the initial quantities, of the
+	// position itself, and of converting the whole deposit into token1 or
+	// token2 at the initial price
+	Hodl      Benchmark
+	Lp        Benchmark
+	LpVsHodl  Benchmark
+	AllToken1 Benchmark
+	AllToken2 Benchmark
+	// Returns accounting for every deposit and withdrawal, from the
+	// position events in token1. Xirr is annualized, TimeWeightedReturn
+	// is not. HasXirr is false when the flows have no XIRR, leaving it zero
+	CashFlows          []CashFlow
+	Xirr               float64
+	HasXirr            bool
+	TimeWeightedReturn float64
 }
 
-func (us UniswapSummaryRequest) Do() []UniswapSummaryResponse {
-	var wg sync.WaitGroup
+// Benchmark is a value expressed in each token of the pair at the final
+// price and, with a PriceOracle, in the quote currency
+type Benchmark struct {
+	Token1 TokenAmount
+	Token2 TokenAmount
+	Quote  TokenAmount
+}
+
+func (us UniswapSummaryRequest) Do() ([]UniswapSummaryResponse, error) {
+	return us.DoContext(context.Background())
+}
+
+func (us UniswapSummaryRequest) DoContext(ctx context.Context) ([]UniswapSummaryResponse, error) {
+	// Positions often share pairs and tokens, so lookups are made once
+	cached := NewCachedDataSource(us.DataSource, 0)
+	us.DataSource = cached
 	results := make([]UniswapSummaryResponse, len(us.LiquidityProviderTokens))
-	for i, t := range us.LiquidityProviderTokens {
-		wg.Add(1)
-		go func(index int, thisT LiquidityProviderPosition) {
+	errs := runPool(ctx, len(results), us.Concurrency, withCacheStats(us.Progress, cached), func(index int) error {
+		var err error
+		results[index], err = us.summarize(ctx, us.LiquidityProviderTokens[index])
+		return err
+	})
+
+	responses := []UniswapSummaryResponse{}
+	var positionErrors PositionErrors
+	for i, err := range errs {
+		if err != nil {
+			positionErrors = append(positionErrors, PositionError{us.LiquidityProviderTokens[i], err})
+			continue
+		}
+		responses = append(responses, results[i])
+	}
+	if ctx.Err() != nil {
+		return responses, ctx.Err()
+	}
+	if len(positionErrors) > 0 {
+		return responses, positionErrors
+	}
+	return responses, nil
+}
+
+// SplitClosed separates responses of positions still held from those
+// fully withdrawn
+func SplitClosed(responses []UniswapSummaryResponse) ([]UniswapSummaryResponse, []UniswapSummaryResponse) {
+	open := []UniswapSummaryResponse{}
+	closed := []UniswapSummaryResponse{}
+	for _, r := range responses {
+		if r.Closed {
+			closed = append(closed, r)
+		} else {
+			open = append(open, r)
+		}
+	}
+	return open, closed
+}
 
-			var balance, supply, liquidity1, liquidity2 float64
+func (us UniswapSummaryRequest) summarize(ctx context.Context, thisT LiquidityProviderPosition) (UniswapSummaryResponse, error) {
 
-			var wg2 sync.WaitGroup
+	if thisT.IsClosed() {
+		if us.PriceOracle != nil {
+			return withQuoteValues(ctx, us.PriceOracle, makeClosedResponse(thisT)), nil
+		}
+		return makeClosedResponse(thisT), nil
+	}
 
-			wg2.Add(1)
-			go func() {
-				if thisT.PairQuantity != 0 {
-					balance = thisT.PairQuantity
-				} else {
-					balance = parseTokenQuantity(getBalance(us, thisT.Pair.Address, us.UserAddress), thisT.Pair.Decimals)
-				}
-				wg2.Done()
-			}()
+	var balance, supply, liquidity1, liquidity2 TokenAmount
+	var rewards []Reward
+	var balanceErr, supplyErr, liquidityErr error
 
-			wg2.Add(1)
-			go func() {
-				supply = parseTokenQuantity(getSupply(us, thisT.Pair.Address), thisT.Pair.Decimals)
-				wg2.Done()
-			}()
+	var wg sync.WaitGroup
 
-			wg2.Add(1)
-			go func() {
-				liquidity1 = parseTokenQuantity(getBalance(us, thisT.Token1.Address, thisT.Pair.Address), thisT.Token1.Decimals)
-				wg2.Done()
-			}()
+	wg.Add(1)
+	go func() {
+		rewards, balanceErr = us.fetchStakedBalance(ctx, thisT, &balance)
+		wg.Done()
+	}()
 
-			wg2.Add(1)
-			go func() {
-				liquidity2 = parseTokenQuantity(getBalance(us, thisT.Token2.Address, thisT.Pair.Address), thisT.Token2.Decimals)
-				wg2.Done()
-			}()
+	wg.Add(1)
+	go func() {
+		var result string
+		result, supplyErr = us.DataSource.GetSupply(ctx, thisT.Pair.Address)
+		if supplyErr == nil {
+			supply, supplyErr = ParseTokenAmount(result, thisT.Pair.Decimals)
+		}
+		wg.Done()
+	}()
 
-			wg2.Wait()
+	wg.Add(1)
+	go func() {
+		liquidity1, liquidity2, liquidityErr = us.fetchLiquidity(ctx, thisT)
+		wg.Done()
+	}()
 
-			results[index] = makeResponse(thisT, balance, supply, liquidity1, liquidity2)
+	wg.Wait()
 
-			wg.Done()
-		}(i, t)
+	for _, err := range []error{balanceErr, supplyErr, liquidityErr} {
+		if err != nil {
+			return UniswapSummaryResponse{}, err
+		}
 	}
-	wg.Wait()
-	return results
+	if supply.IsZero() {
+		return UniswapSummaryResponse{}, malformed("pair %s has zero supply", thisT.Pair.Address)
+	}
+
+	response := makeResponse(thisT, balance, supply, liquidity1, liquidity2)
+	response = withCashFlowReturns(response, response.Lp.Token1.Rat(), time.Now())
+	if len(thisT.Lots) > 1 {
+		for _, lot := range thisT.Lots {
+			share := new(big.Rat).Quo(lot.PairQuantity.Rat(), thisT.PairQuantity.Rat())
+			lotBalance := TokenAmountFromRat(share.Mul(share, balance.Rat()), balance.Decimals)
+			response.Lots = append(response.Lots, makeResponse(thisT.lotPosition(lot), lotBalance, supply, liquidity1, liquidity2))
+		}
+	}
+	response.Realized = makeRealizedResponses(thisT)
+	response.Rewards = rewards
+	if us.PriceOracle != nil {
+		return withQuoteValues(ctx, us.PriceOracle, response), nil
+	}
+	return response, nil
 }
 
-func daysSince(start time.Time) float64 {
-	end := time.Now()
-	return end.Sub(start).Hours() / 24.0
+// fetchStakedBalance sets the balance to the LP tokens held in the owner
+// wallets plus those staked, unless known from the wallet history
+func (us UniswapSummaryRequest) fetchStakedBalance(ctx context.Context, thisT LiquidityProviderPosition, balance *TokenAmount) ([]Reward, error) {
+	if !thisT.PairQuantity.IsZero() {
+		*balance = thisT.PairQuantity
+	} else {
+		*balance = NewTokenAmount(new(big.Int), thisT.Pair.Decimals)
+		for _, w := range us.wallets() {
+			walletBalance, err := us.fetchBalance(ctx, thisT.Pair, w)
+			if err != nil {
+				return nil, err
+			}
+			*balance = balance.Add(walletBalance)
+		}
+	}
+	var rewards []Reward
+	for _, contract := range us.stakingContractsFor(thisT) {
+		for _, w := range us.wallets() {
+			staked, reward, err := us.fetchStaked(ctx, thisT, contract, w)
+			if errors.Is(err, ErrNotSupported) && !thisT.isStakedIn(contract) {
+				// Registered contracts are only looked up when possible
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if thisT.PairQuantity.IsZero() {
+				*balance = balance.Add(staked)
+			}
+			if !staked.IsZero() || !reward.Quantity.IsZero() {
+				rewards = append(rewards, reward)
+			}
+		}
+	}
+	return rewards, nil
 }
 
-func handleError(err error) {
+func (us UniswapSummaryRequest) fetchLiquidity(ctx context.Context, thisT LiquidityProviderPosition) (TokenAmount, TokenAmount, error) {
+	if pairReader, ok := us.DataSource.(PairReader); ok {
+		liquidity1, liquidity2, err := fetchReserves(ctx, pairReader, thisT)
+		if !errors.Is(err, ErrNotSupported) {
+			return liquidity1, liquidity2, err
+		}
+	}
+	liquidity1, err := us.fetchBalance(ctx, thisT.Token1, thisT.Pair.Address)
 	if err != nil {
-		panic(err)
+		return TokenAmount{}, TokenAmount{}, err
 	}
+	liquidity2, err := us.fetchBalance(ctx, thisT.Token2, thisT.Pair.Address)
+	if err != nil {
+		return TokenAmount{}, TokenAmount{}, err
+	}
+	return liquidity1, liquidity2, nil
 }
 
-func parseTokenQuantity(quantity string, decimals int) float64 {
-	q, err := strconv.ParseFloat(quantity, 64)
-	handleError(err)
-	return q * math.Pow(10, -float64(decimals))
+// Reserves exclude tokens sent to the pair but not yet synced, matching
+// the values Uniswap uses for pricing and for the constant product
+func fetchReserves(ctx context.Context, pairReader PairReader, thisT LiquidityProviderPosition) (TokenAmount, TokenAmount, error) {
+	token0, err := pairReader.GetToken0(ctx, thisT.Pair.Address)
+	if err != nil {
+		return TokenAmount{}, TokenAmount{}, err
+	}
+	reserve0, reserve1, err := pairReader.GetReserves(ctx, thisT.Pair.Address)
+	if err != nil {
+		return TokenAmount{}, TokenAmount{}, err
+	}
+	if !icaseCompare(token0, thisT.Token1.Address) {
+		if !icaseCompare(token0, thisT.Token2.Address) {
+			return TokenAmount{}, TokenAmount{}, malformed("pair %s token0 %s is neither %s nor %s", thisT.Pair.Address, token0, thisT.Token1.Id, thisT.Token2.Id)
+		}
+		reserve0, reserve1 = reserve1, reserve0
+	}
+	liquidity1, err := ParseTokenAmount(reserve0, thisT.Token1.Decimals)
+	if err != nil {
+		return TokenAmount{}, TokenAmount{}, err
+	}
+	liquidity2, err := ParseTokenAmount(reserve1, thisT.Token2.Decimals)
+	if err != nil {
+		return TokenAmount{}, TokenAmount{}, err
+	}
+	return liquidity1, liquidity2, nil
+}
+
+func (us UniswapSummaryRequest) fetchBalance(ctx context.Context, token Token, walletAddress string) (TokenAmount, error) {
+	result, err := us.DataSource.GetBalance(ctx, token.Address, walletAddress)
+	if err != nil {
+		return TokenAmount{}, err
+	}
+	return ParseTokenAmount(result, token.Decimals)
+}
+
+func daysBetween(start time.Time, end time.Time) float64 {
+	return end.Sub(start).Hours() / 24.0
 }
 
 func log(i ...interface{}) {
@@ -150,52 +377,209 @@ func log(i ...interface{}) {
 	}
 }
 
-func makeResponse(thisT LiquidityProviderPosition, balance, supply, liquidity1, liquidity2 float64) UniswapSummaryResponse {
+func makeResponse(thisT LiquidityProviderPosition, balance, supply, liquidity1, liquidity2 TokenAmount) UniswapSummaryResponse {
 
-	token1FinalQuantity := balance / supply * liquidity1
-	token2FinalQuantity := balance / supply * liquidity2
-	initialK := thisT.Token1InitialQuantity * thisT.Token2InitialQuantity
-	totalK := liquidity1 * liquidity2
-	myK := math.Pow(balance/supply, 2) * totalK
-	ratioK := myK / initialK
+	share := new(big.Rat).Quo(balance.Rat(), supply.Rat())
+	token1Final := new(big.Rat).Mul(share, liquidity1.Rat())
+	token2Final := new(big.Rat).Mul(share, liquidity2.Rat())
+
+	response := summarizeQuantities(thisT, token1Final, token2Final, time.Now())
+	response.Balance = balance
+	response.Supply = supply
+	response.Liquidity1 = liquidity1
+	response.Liquidity2 = liquidity2
+	response.TotalK = newBigFloat(new(big.Rat).Mul(liquidity1.Rat(), liquidity2.Rat()))
+
+	return response
+}
+
+func makeClosedResponse(thisT LiquidityProviderPosition) UniswapSummaryResponse {
+	closed := thisT.lotPosition(Lot{})
+	token1Final := new(big.Rat)
+	token2Final := new(big.Rat)
+	var end time.Time
+	for i, c := range thisT.ClosedLots {
+		closed.Token1InitialQuantity = closed.Token1InitialQuantity.Add(c.Token1Quantity)
+		closed.Token2InitialQuantity = closed.Token2InitialQuantity.Add(c.Token2Quantity)
+		closed.GasCost = closed.GasCost.Add(c.GasCost).Add(c.CloseGasCost)
+		token1Final.Add(token1Final, c.Token1FinalQuantity.Rat())
+		token2Final.Add(token2Final, c.Token2FinalQuantity.Rat())
+		if i == 0 || c.Date.Before(closed.InitialDate) {
+			closed.InitialDate = c.Date
+			closed.InitialBlock = c.Block
+		}
+		if c.CloseDate.After(end) {
+			end = c.CloseDate
+		}
+	}
+	response := summarizeQuantities(closed, token1Final, token2Final, end)
+	response.Token = thisT
+	response = withCashFlowReturns(response, new(big.Rat), end)
+	response.Closed = true
+	response.Realized = makeRealizedResponses(thisT)
+	return response
+}
+
+func makeRealizedResponses(thisT LiquidityProviderPosition) []UniswapSummaryResponse {
+	var responses []UniswapSummaryResponse
+	for _, c := range thisT.ClosedLots {
+		closed := thisT.lotPosition(c.Lot)
+		closed.GasCost = c.GasCost.Add(c.CloseGasCost)
+		response := summarizeQuantities(closed, c.Token1FinalQuantity.Rat(), c.Token2FinalQuantity.Rat(), c.CloseDate)
+		response.Closed = true
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// summarizeQuantities compares the initial quantities of a position with
+// the quantities it is worth at the end date
+func summarizeQuantities(thisT LiquidityProviderPosition, token1Final, token2Final *big.Rat, end time.Time) UniswapSummaryResponse {
+
+	initialK := new(big.Rat).Mul(thisT.Token1InitialQuantity.Rat(), thisT.Token2InitialQuantity.Rat())
+	myK := new(big.Rat).Mul(token1Final, token2Final)
+	ratioK := ratFloat64(myK) / ratFloat64(initialK)
+	if initialK.Sign() != 0 {
+		ratioK = ratFloat64(new(big.Rat).Quo(myK, initialK))
+	}
 	percentageFees := (math.Pow(ratioK, 0.5) - 1.0) * 100.0
-	token1Fee := token1FinalQuantity * (1.0 - 1.0/math.Pow(ratioK, 0.5))
-	token2Fee := token2FinalQuantity * (1.0 - 1.0/math.Pow(ratioK, 0.5))
-	initialPrice := thisT.Token1InitialQuantity / thisT.Token2InitialQuantity
-	finalPrice := token1FinalQuantity / token2FinalQuantity
-	priceRatio := finalPrice / initialPrice
+	feeShare := feeShare(initialK, myK)
+	token1Fee := new(big.Rat).Mul(token1Final, feeShare)
+	token2Fee := new(big.Rat).Mul(token2Final, feeShare)
+	initialPrice := quoFloat(thisT.Token1InitialQuantity.Rat(), thisT.Token2InitialQuantity.Rat())
+	finalPrice := quoFloat(token1Final, token2Final)
+	finalPriceFloat, _ := finalPrice.Float64()
+	initialPriceFloat, _ := initialPrice.Float64()
+	priceRatio := finalPriceFloat / initialPriceFloat
 	divergenceLoss := (2.0*math.Sqrt(priceRatio)/(1.0+priceRatio) - 1.0) * 100.0
 	accruedProfit := ((1.0+percentageFees/100.0)*(1.0+divergenceLoss/100.0) - 1.0) * 100.0
-	daysEllapsed := daysSince(thisT.InitialDate)
-	yearlyProfit := (math.Pow(1.0+accruedProfit/100.0, 365.0/daysEllapsed) - 1.0) * 100.0
+	daysEllapsed := daysBetween(thisT.InitialDate, end)
+
+	// Lots added and removed in the same block have no yearly figures
+	var yearlyProfit float64
+	if daysEllapsed > 0 {
+		yearlyProfit = (math.Pow(1.0+accruedProfit/100.0, 365.0/daysEllapsed) - 1.0) * 100.0
+	}
 
-	// Is this a positive or negative position?
-	signal := math.Abs(balance) / balance
+	token1FinalQuantity := TokenAmountFromRat(token1Final, thisT.Token1.Decimals)
+	token2FinalQuantity := TokenAmountFromRat(token2Final, thisT.Token2.Decimals)
 
 	response := UniswapSummaryResponse{
 		Token:               thisT,
-		Balance:             balance,
-		Supply:              supply,
-		Liquidity1:          liquidity1,
-		Liquidity2:          liquidity2,
-		InitialK:            initialK,
+		InitialK:            newBigFloat(initialK),
 		Token1FinalQuantity: token1FinalQuantity,
 		Token2FinalQuantity: token2FinalQuantity,
-		Token1Increase:      token1FinalQuantity - thisT.Token1InitialQuantity,
-		Token2Increase:      token2FinalQuantity - thisT.Token2InitialQuantity,
+		Token1Increase:      token1FinalQuantity.Sub(thisT.Token1InitialQuantity),
+		Token2Increase:      token2FinalQuantity.Sub(thisT.Token2InitialQuantity),
 		InitialPrice:        initialPrice,
 		FinalPrice:          finalPrice,
-		DivergenceLoss:      divergenceLoss * signal,
-		AccruedProfit:       accruedProfit * signal,
+		DivergenceLoss:      divergenceLoss,
+		AccruedProfit:       accruedProfit,
 		DaysEllapsed:        daysEllapsed,
-		YearlyProfit:        yearlyProfit * signal,
-		Token1Fee:           token1Fee,
-		Token2Fee:           token2Fee,
-		PercentageFees:      percentageFees * signal,
+		YearlyProfit:        yearlyProfit,
+		Token1Fee:           TokenAmountFromRat(token1Fee, thisT.Token1.Decimals),
+		Token2Fee:           TokenAmountFromRat(token2Fee, thisT.Token2.Decimals),
+		PercentageFees:      percentageFees,
 		RatioK:              ratioK,
-		MyK:                 myK,
-		TotalK:              totalK,
+		MyK:                 newBigFloat(myK),
+		GasCost:             thisT.GasCost,
+	}
+	if gasPercentage, ok := gasPercentage(thisT, token1Final, token2Final); ok {
+		response = withNetOfGas(response, gasPercentage)
+	}
+
+	if token1Final.Sign() != 0 && token2Final.Sign() != 0 {
+		response = withBenchmarks(response, token1Final, token2Final)
+	}
+
+	return response
+}
+
+// withBenchmarks compares the position with holding, measured in token1
+// at the final price and converted to token2
+func withBenchmarks(response UniswapSummaryResponse, token1Final, token2Final *big.Rat) UniswapSummaryResponse {
+	thisT := response.Token
+	finalPrice := new(big.Rat).Quo(token1Final, token2Final)
+	token1Initial := thisT.Token1InitialQuantity.Rat()
+	token2Initial := thisT.Token2InitialQuantity.Rat()
+	benchmark := func(valueInToken1 *big.Rat) Benchmark {
+		return Benchmark{
+			Token1: TokenAmountFromRat(valueInToken1, thisT.Token1.Decimals),
+			Token2: TokenAmountFromRat(new(big.Rat).Quo(valueInToken1, finalPrice), thisT.Token2.Decimals),
+		}
 	}
 
+	hodl := new(big.Rat).Mul(token2Initial, finalPrice)
+	hodl.Add(hodl, token1Initial)
+	lp := new(big.Rat).Mul(token2Final, finalPrice)
+	lp.Add(lp, token1Final)
+	response.Hodl = benchmark(hodl)
+	response.Lp = benchmark(lp)
+	response.LpVsHodl = benchmark(new(big.Rat).Sub(lp, hodl))
+
+	if token1Initial.Sign() != 0 && token2Initial.Sign() != 0 {
+		initialPrice := new(big.Rat).Quo(token1Initial, token2Initial)
+		allToken1 := new(big.Rat).Mul(token2Initial, initialPrice)
+		allToken1.Add(allToken1, token1Initial)
+		response.AllToken1 = benchmark(allToken1)
+		allToken2 := new(big.Rat).Quo(token1Initial, initialPrice)
+		allToken2.Add(allToken2, token2Initial)
+		response.AllToken2 = benchmark(allToken2.Mul(allToken2, finalPrice))
+	}
 	return response
 }
+
+// gasPercentage is the gas cost relative to the value of the initial
+// quantities at the current price, both measured in token1
+func gasPercentage(thisT LiquidityProviderPosition, token1Final, token2Final *big.Rat) (float64, bool) {
+	if token1Final.Sign() == 0 || token2Final.Sign() == 0 {
+		return 0, false
+	}
+	price := new(big.Rat).Quo(token1Final, token2Final)
+	gasInToken1 := thisT.GasCost.Rat()
+	if icaseCompare(thisT.Token2.Address, TOKEN_WETH.Address) {
+		gasInToken1.Mul(gasInToken1, price)
+	} else if !icaseCompare(thisT.Token1.Address, TOKEN_WETH.Address) {
+		return 0, false
+	}
+	hodlValue := new(big.Rat).Mul(thisT.Token2InitialQuantity.Rat(), price)
+	hodlValue.Add(hodlValue, thisT.Token1InitialQuantity.Rat())
+	if hodlValue.Sign() == 0 {
+		return 0, false
+	}
+	return ratFloat64(new(big.Rat).Quo(gasInToken1, hodlValue)) * 100.0, true
+}
+
+// feeShare is the part of the final quantities earned as fees,
+// 1 - sqrt(initialK/myK)
+func feeShare(initialK, myK *big.Rat) *big.Rat {
+	if myK.Sign() <= 0 {
+		return new(big.Rat)
+	}
+	if initialK.Sign() <= 0 {
+		return big.NewRat(1, 1)
+	}
+	root, _ := new(big.Float).SetPrec(BIG_FLOAT_PRECISION).Sqrt(newBigFloat(new(big.Rat).Quo(initialK, myK))).Rat(nil)
+	return root.Sub(big.NewRat(1, 1), root)
+}
+
+// withNetOfGas sets the profit figures after paying for gas, given as a
+// percentage of the value of the initial quantities
+func withNetOfGas(response UniswapSummaryResponse, gasPercentage float64) UniswapSummaryResponse {
+	response.AccruedProfitNetOfGas = response.AccruedProfit - gasPercentage
+	response.YearlyProfitNetOfGas = 0
+	if response.DaysEllapsed > 0 {
+		response.YearlyProfitNetOfGas = (math.Pow(1.0+response.AccruedProfitNetOfGas/100.0, 365.0/response.DaysEllapsed) - 1.0) * 100.0
+	}
+	response.HasNetOfGas = true
+	return response
+}
+
+// quoFloat divides two quantities, yielding +Inf for a zero divisor as
+// float64 division would
+func quoFloat(a, b *big.Rat) *big.Float {
+	if b.Sign() == 0 {
+		return new(big.Float).SetInf(a.Sign() < 0)
+	}
+	return newBigFloat(new(big.Rat).Quo(a, b))
+}
@@ -0,0 +1,74 @@
+package unisummary
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSummarizeQuantitiesNetOfGas(t *testing.T) {
+	end := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	dai := Token{"DAI", testToken1, 18}
+	position := func(token1, token2 Token, quantity1, quantity2 int64) LiquidityProviderPosition {
+		return LiquidityProviderPosition{
+			Token1: token1, Token2: token2, InitialDate: end.AddDate(0, 0, -365),
+			Token1InitialQuantity: NewTokenAmount(new(big.Int).Mul(big.NewInt(quantity1), pow10(token1.Decimals)), token1.Decimals),
+			Token2InitialQuantity: NewTokenAmount(new(big.Int).Mul(big.NewInt(quantity2), pow10(token2.Decimals)), token2.Decimals),
+			// 0.01 WETH
+			GasCost: NewTokenAmount(pow10(16), TOKEN_WETH.Decimals),
+		}
+	}
+	oracle := StaticPriceOracle{TOKEN_USDC, map[string]*big.Rat{"DAI": big.NewRat(1, 1), "WETH": big.NewRat(2000, 1)}}
+	tests := []struct {
+		name        string
+		position    LiquidityProviderPosition
+		final1      int64
+		final2      int64
+		oracle      PriceOracle
+		hasNetOfGas bool
+		netOfGas    float64
+	}{
+		{"WETH pair", position(TOKEN_WETH, TOKEN_USDC, 1, 2000), 1, 2000, nil, true, -0.5},
+		{"pair without WETH", position(TOKEN_USDC, dai, 100, 100), 110, 110, nil, false, 0},
+		{"pair without WETH valued through the oracle", position(TOKEN_USDC, dai, 100, 100), 110, 110, oracle, true, 0},
+		{"pair without WETH and no WETH price", position(TOKEN_USDC, dai, 100, 100), 110, 110, StaticPriceOracle{TOKEN_USDC, map[string]*big.Rat{"DAI": big.NewRat(1, 1)}}, false, 0},
+	}
+	for _, test := range tests {
+		response := summarizeQuantities(test.position, big.NewRat(test.final1, 1), big.NewRat(test.final2, 1), end)
+		if test.oracle != nil {
+			response = withQuoteValues(context.Background(), test.oracle, response)
+			if response.QuoteError != "" {
+				t.Fatalf("%s: QuoteError = %q", test.name, response.QuoteError)
+			}
+		}
+		if response.HasNetOfGas != test.hasNetOfGas || math.Abs(response.AccruedProfitNetOfGas-test.netOfGas) > 1e-9 {
+			t.Errorf("%s: HasNetOfGas = %v, AccruedProfitNetOfGas = %v, want %v and %v", test.name, response.HasNetOfGas, response.AccruedProfitNetOfGas, test.hasNetOfGas, test.netOfGas)
+		}
+		if !test.hasNetOfGas && response.YearlyProfitNetOfGas != 0 {
+			t.Errorf("%s: YearlyProfitNetOfGas = %v without gas value", test.name, response.YearlyProfitNetOfGas)
+		}
+	}
+}
+
+func TestFeeShare(t *testing.T) {
+	tests := []struct {
+		name          string
+		initialK, myK *big.Rat
+		want          *big.Rat
+	}{
+		{"k quadrupled", big.NewRat(1, 1), big.NewRat(4, 1), big.NewRat(1, 2)},
+		{"k unchanged", big.NewRat(7, 3), big.NewRat(7, 3), new(big.Rat)},
+		{"large quantities", new(big.Rat).SetInt(new(big.Int).Mul(pow10(40), big.NewInt(100))), new(big.Rat).SetInt(new(big.Int).Mul(pow10(40), big.NewInt(121))), big.NewRat(1, 11)},
+		{"nothing deposited", new(big.Rat), big.NewRat(4, 1), big.NewRat(1, 1)},
+		{"nothing left", big.NewRat(4, 1), new(big.Rat), new(big.Rat)},
+	}
+	for _, test := range tests {
+		got := feeShare(test.initialK, test.myK)
+		diff := new(big.Rat).Sub(got, test.want)
+		if diff.Abs(diff).Cmp(new(big.Rat).SetFrac(big.NewInt(1), pow10(60))) > 0 {
+			t.Errorf("%s: feeShare = %s, want %s", test.name, got.FloatString(20), test.want.FloatString(20))
+		}
+	}
+}
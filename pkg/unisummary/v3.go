@@ -0,0 +1,502 @@
+package unisummary
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+const SELECTOR_V3_POSITIONS = "0x99fbab88"
+const SELECTOR_V3_GET_POOL = "0x1698ee82"
+const SELECTOR_V3_SLOT0 = "0x3850c7bd"
+const SELECTOR_V3_FEE_GROWTH_GLOBAL0 = "0xf3058399"
+const SELECTOR_V3_FEE_GROWTH_GLOBAL1 = "0x46141319"
+const SELECTOR_V3_TICKS = "0xf30dba93"
+
+const TOPIC_V3_INCREASE_LIQUIDITY = "0x3067048beee31b25b2f1681f88dac838c8bba36af25bfb2b7cf7473a5847e35f"
+
+// V3Position is a Uniswap V3 concentrated liquidity NFT position.
+// Quantities are in token0, token1 order as in the pool
+type V3Position struct {
+	TokenId               *big.Int
+	Token0                Token
+	Token1                Token
+	Fee                   int
+	TickLower             int
+	TickUpper             int
+	Liquidity             *big.Int
+	Token0InitialQuantity TokenAmount
+	Token1InitialQuantity TokenAmount
+	InitialDate           time.Time
+}
+
+// V3SummaryResponse values everything in token1 at the current pool price.
+// Token quantities exclude the uncollected fees, reported separately
+type V3SummaryResponse struct {
+	Position       V3Position
+	Pool           string
+	CurrentTick    int
+	InRange        bool
+	Token0Quantity TokenAmount
+	Token1Quantity TokenAmount
+	Token0Fee      TokenAmount
+	Token1Fee      TokenAmount
+	FinalPrice     *big.Float
+	PercentageFees float64
+	DivergenceLoss float64
+	AccruedProfit  float64
+	DaysEllapsed   float64
+	YearlyProfit   float64
+}
+
+func (us UniswapSummaryRequest) DoV3() ([]V3SummaryResponse, error) {
+	return us.DoV3Context(context.Background())
+}
+
+func (us UniswapSummaryRequest) DoV3Context(ctx context.Context) ([]V3SummaryResponse, error) {
+	// The cache forwards every optional interface, so the check is made on
+	// the source it wraps
+	if _, ok := us.DataSource.(ContractCaller); !ok {
+		return nil, fmt.Errorf("%w: uniswap v3 requires contract calls", ErrNotSupported)
+	}
+	caller := NewCachedDataSource(us.DataSource, 0)
+	results := make([]V3SummaryResponse, len(us.V3Positions))
+	errs := runPool(ctx, len(results), us.Concurrency, withCacheStats(us.Progress, caller), func(index int) error {
+		var err error
+		results[index], err = summarizeV3(ctx, caller, us.V3Positions[index])
+		return err
+	})
+
+	responses := []V3SummaryResponse{}
+	var positionErrors V3PositionErrors
+	for i, err := range errs {
+		if err != nil {
+			positionErrors = append(positionErrors, V3PositionError{us.V3Positions[i], err})
+			continue
+		}
+		responses = append(responses, results[i])
+	}
+	if ctx.Err() != nil {
+		return responses, ctx.Err()
+	}
+	if len(positionErrors) > 0 {
+		return responses, positionErrors
+	}
+	return responses, nil
+}
+
+type v3Tick struct {
+	FeeGrowthOutside0 *big.Int
+	FeeGrowthOutside1 *big.Int
+}
+
+func summarizeV3(ctx context.Context, caller ContractCaller, position V3Position) (V3SummaryResponse, error) {
+	current, err := readV3Position(ctx, caller, position.TokenId)
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	// Positions given only by their token id
+	if position.Token0.Address == "" {
+		position.Token0, err = callToken(ctx, caller, current.token0)
+		if err != nil {
+			return V3SummaryResponse{}, err
+		}
+	}
+	if position.Token1.Address == "" {
+		position.Token1, err = callToken(ctx, caller, current.token1)
+		if err != nil {
+			return V3SummaryResponse{}, err
+		}
+	}
+	pool, err := callAddress(ctx, caller, UNISWAP_V3_FACTORY_ADDRESS, encodeCall(SELECTOR_V3_GET_POOL,
+		encodeAddress(current.token0), encodeAddress(current.token1), encodeUint(big.NewInt(int64(current.fee)))))
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	slot0, err := caller.Call(ctx, pool, encodeCall(SELECTOR_V3_SLOT0))
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	sqrtPriceX96, err := decodeUint(slot0, 0)
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	tick, err := decodeInt(slot0, 1)
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	global := [2]*big.Int{}
+	for i, selector := range []string{SELECTOR_V3_FEE_GROWTH_GLOBAL0, SELECTOR_V3_FEE_GROWTH_GLOBAL1} {
+		result, err := caller.Call(ctx, pool, encodeCall(selector))
+		if err != nil {
+			return V3SummaryResponse{}, err
+		}
+		global[i], err = decodeUint(result, 0)
+		if err != nil {
+			return V3SummaryResponse{}, err
+		}
+	}
+	lower, err := readV3Tick(ctx, caller, pool, current.tickLower)
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+	upper, err := readV3Tick(ctx, caller, pool, current.tickUpper)
+	if err != nil {
+		return V3SummaryResponse{}, err
+	}
+
+	position.Fee = current.fee
+	position.TickLower = current.tickLower
+	position.TickUpper = current.tickUpper
+	position.Liquidity = current.liquidity
+
+	inside0 := feeGrowthInside(global[0], lower.FeeGrowthOutside0, upper.FeeGrowthOutside0, tick, current.tickLower, current.tickUpper)
+	inside1 := feeGrowthInside(global[1], lower.FeeGrowthOutside1, upper.FeeGrowthOutside1, tick, current.tickLower, current.tickUpper)
+	fee0 := uncollectedFees(current.tokensOwed0, current.liquidity, inside0, current.feeGrowthInside0Last)
+	fee1 := uncollectedFees(current.tokensOwed1, current.liquidity, inside1, current.feeGrowthInside1Last)
+
+	sqrtPrice := new(big.Float).SetPrec(BIG_FLOAT_PRECISION).Quo(
+		new(big.Float).SetInt(sqrtPriceX96), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96)))
+	amount0, amount1 := v3Amounts(current.liquidity, sqrtPrice, tickSqrtPrice(current.tickLower), tickSqrtPrice(current.tickUpper))
+
+	token0Quantity := TokenAmountFromRat(floatRat(amount0), 0)
+	token0Quantity.Decimals = position.Token0.Decimals
+	token1Quantity := TokenAmountFromRat(floatRat(amount1), 0)
+	token1Quantity.Decimals = position.Token1.Decimals
+	token0Fee := NewTokenAmount(fee0, position.Token0.Decimals)
+	token1Fee := NewTokenAmount(fee1, position.Token1.Decimals)
+
+	// Price of token0 in token1, in token units
+	price := new(big.Float).Mul(sqrtPrice, sqrtPrice)
+	price.Mul(price, newBigFloat(new(big.Rat).SetFrac(pow10(position.Token0.Decimals), pow10(position.Token1.Decimals))))
+	priceRat := floatRat(price)
+
+	principalValue := v3Value(token0Quantity, token1Quantity, priceRat)
+	feeValue := v3Value(token0Fee, token1Fee, priceRat)
+	hodlValue := v3Value(position.Token0InitialQuantity, position.Token1InitialQuantity, priceRat)
+
+	percentageFees, divergenceLoss, accruedProfit, daysEllapsed, yearlyProfit := v3Returns(principalValue, feeValue, hodlValue, position.InitialDate, time.Now())
+
+	return V3SummaryResponse{
+		Position:       position,
+		Pool:           pool,
+		CurrentTick:    tick,
+		InRange:        tick >= current.tickLower && tick < current.tickUpper,
+		Token0Quantity: token0Quantity,
+		Token1Quantity: token1Quantity,
+		Token0Fee:      token0Fee,
+		Token1Fee:      token1Fee,
+		FinalPrice:     price,
+		PercentageFees: percentageFees,
+		DivergenceLoss: divergenceLoss,
+		AccruedProfit:  accruedProfit,
+		DaysEllapsed:   daysEllapsed,
+		YearlyProfit:   yearlyProfit,
+	}, nil
+}
+
+// v3Returns leaves zero the figures without a base: fees of a position
+// with no liquidity, divergence without initial quantities and time based
+// figures without an initial date, unknown for positions found from node
+// logs
+func v3Returns(principalValue, feeValue, hodlValue *big.Rat, initialDate time.Time, now time.Time) (percentageFees, divergenceLoss, accruedProfit, daysEllapsed, yearlyProfit float64) {
+	if principalValue.Sign() != 0 {
+		percentageFees = ratFloat64(new(big.Rat).Quo(feeValue, principalValue)) * 100.0
+	}
+	if hodlValue.Sign() != 0 {
+		divergenceLoss = (ratFloat64(new(big.Rat).Quo(principalValue, hodlValue)) - 1.0) * 100.0
+	}
+	accruedProfit = ((1.0+percentageFees/100.0)*(1.0+divergenceLoss/100.0) - 1.0) * 100.0
+	if !initialDate.IsZero() {
+		daysEllapsed = daysBetween(initialDate, now)
+	}
+	if daysEllapsed > 0 {
+		yearlyProfit = (math.Pow(1.0+accruedProfit/100.0, 365.0/daysEllapsed) - 1.0) * 100.0
+	}
+	return percentageFees, divergenceLoss, accruedProfit, daysEllapsed, yearlyProfit
+}
+
+type v3PositionState struct {
+	token0               string
+	token1               string
+	fee                  int
+	tickLower            int
+	tickUpper            int
+	liquidity            *big.Int
+	feeGrowthInside0Last *big.Int
+	feeGrowthInside1Last *big.Int
+	tokensOwed0          *big.Int
+	tokensOwed1          *big.Int
+}
+
+func readV3Position(ctx context.Context, caller ContractCaller, tokenId *big.Int) (v3PositionState, error) {
+	result, err := caller.Call(ctx, UNISWAP_V3_POSITION_MANAGER_ADDRESS, encodeCall(SELECTOR_V3_POSITIONS, encodeUint(tokenId)))
+	if err != nil {
+		return v3PositionState{}, err
+	}
+	words, err := decodeWords(result, 12)
+	if err != nil {
+		return v3PositionState{}, err
+	}
+	token0, _ := decodeAddress(result, 2)
+	token1, _ := decodeAddress(result, 3)
+	tickLower, _ := decodeInt(result, 5)
+	tickUpper, _ := decodeInt(result, 6)
+	return v3PositionState{
+		token0:               token0,
+		token1:               token1,
+		fee:                  int(words[4].Int64()),
+		tickLower:            tickLower,
+		tickUpper:            tickUpper,
+		liquidity:            words[7],
+		feeGrowthInside0Last: words[8],
+		feeGrowthInside1Last: words[9],
+		tokensOwed0:          words[10],
+		tokensOwed1:          words[11],
+	}, nil
+}
+
+func readV3Tick(ctx context.Context, caller ContractCaller, pool string, tick int) (v3Tick, error) {
+	result, err := caller.Call(ctx, pool, encodeCall(SELECTOR_V3_TICKS, encodeInt(tick)))
+	if err != nil {
+		return v3Tick{}, err
+	}
+	words, err := decodeWords(result, 4)
+	if err != nil {
+		return v3Tick{}, err
+	}
+	return v3Tick{words[2], words[3]}, nil
+}
+
+var uint256Modulus = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// feeGrowthInside follows the pool contract, including its wrapping
+// uint256 arithmetic
+func feeGrowthInside(global, outsideLower, outsideUpper *big.Int, tick, tickLower, tickUpper int) *big.Int {
+	below := outsideLower
+	if tick < tickLower {
+		below = new(big.Int).Sub(global, outsideLower)
+	}
+	above := outsideUpper
+	if tick >= tickUpper {
+		above = new(big.Int).Sub(global, outsideUpper)
+	}
+	inside := new(big.Int).Sub(global, below)
+	inside.Sub(inside, above)
+	return inside.Mod(inside, uint256Modulus)
+}
+
+func uncollectedFees(owed, liquidity, inside, insideLast *big.Int) *big.Int {
+	growth := new(big.Int).Sub(inside, insideLast)
+	growth.Mod(growth, uint256Modulus)
+	fees := new(big.Int).Mul(liquidity, growth)
+	fees.Rsh(fees, 128)
+	return fees.Add(fees, owed)
+}
+
+func tickSqrtPrice(tick int) *big.Float {
+	return new(big.Float).SetPrec(BIG_FLOAT_PRECISION).SetFloat64(math.Pow(1.0001, float64(tick)/2.0))
+}
+
+// v3Amounts returns the raw token amounts of a liquidity over the range
+// [sqrtA, sqrtB] at the sqrt price sqrtP
+func v3Amounts(liquidity *big.Int, sqrtP, sqrtA, sqrtB *big.Float) (*big.Float, *big.Float) {
+	l := new(big.Float).SetPrec(BIG_FLOAT_PRECISION).SetInt(liquidity)
+	amount0 := new(big.Float).SetPrec(BIG_FLOAT_PRECISION)
+	amount1 := new(big.Float).SetPrec(BIG_FLOAT_PRECISION)
+	if sqrtP.Cmp(sqrtA) <= 0 {
+		amount0.Quo(new(big.Float).Sub(sqrtB, sqrtA), new(big.Float).Mul(sqrtA, sqrtB))
+		amount0.Mul(amount0, l)
+	} else if sqrtP.Cmp(sqrtB) >= 0 {
+		amount1.Mul(l, new(big.Float).Sub(sqrtB, sqrtA))
+	} else {
+		amount0.Quo(new(big.Float).Sub(sqrtB, sqrtP), new(big.Float).Mul(sqrtP, sqrtB))
+		amount0.Mul(amount0, l)
+		amount1.Mul(l, new(big.Float).Sub(sqrtP, sqrtA))
+	}
+	return amount0, amount1
+}
+
+func v3Value(amount0, amount1 TokenAmount, price *big.Rat) *big.Rat {
+	value := new(big.Rat).Mul(amount0.Rat(), price)
+	return value.Add(value, amount1.Rat())
+}
+
+func floatRat(f *big.Float) *big.Rat {
+	r, _ := f.Rat(nil)
+	if r == nil {
+		return new(big.Rat)
+	}
+	return r
+}
+
+func decodeInt(result string, index int) (int, error) {
+	value, err := decodeUint(result, index)
+	if err != nil {
+		return 0, err
+	}
+	if value.Bit(255) == 1 {
+		value.Sub(value, uint256Modulus)
+	}
+	return int(value.Int64()), nil
+}
+
+func encodeInt(value int) string {
+	v := big.NewInt(int64(value))
+	if v.Sign() < 0 {
+		v.Add(v, uint256Modulus)
+	}
+	return encodeUint(v)
+}
+
+func V3PositionsFromWalletAddress(us *UniswapSummaryRequest) ([]V3Position, error) {
+	return V3PositionsFromWalletAddressContext(context.Background(), us)
+}
+
+// V3PositionsFromWalletAddressContext finds the position NFTs held by the
+// user and their deposits from the position manager logs. Logs fetched
+// from a node carry no timestamp, leaving InitialDate unknown
+func V3PositionsFromWalletAddressContext(ctx context.Context, us *UniswapSummaryRequest) ([]V3Position, error) {
+	logSource, isLogSource := us.DataSource.(LogSource)
+	caller, isCaller := us.DataSource.(ContractCaller)
+	if !isLogSource || !isCaller {
+		return nil, fmt.Errorf("%w: uniswap v3 requires logs and contract calls", ErrNotSupported)
+	}
+	transfers := []Log{}
+	seen := map[string]bool{}
+	for _, w := range us.wallets() {
+		wallet := "0x" + encodeAddress(w)
+		received, err := logSource.GetLogs(ctx, LogQuery{
+			Address: UNISWAP_V3_POSITION_MANAGER_ADDRESS,
+			ToBlock: ETHERSCAN_LATEST_BLOCK,
+			Topics:  []string{TOPIC_TRANSFER, "", wallet},
+		})
+		if err != nil {
+			return nil, err
+		}
+		sent, err := logSource.GetLogs(ctx, LogQuery{
+			Address: UNISWAP_V3_POSITION_MANAGER_ADDRESS,
+			ToBlock: ETHERSCAN_LATEST_BLOCK,
+			Topics:  []string{TOPIC_TRANSFER, wallet},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range append(received, sent...) {
+			key := fmt.Sprintf("%s/%d", l.TransactionHash, l.LogIndex)
+			if !seen[key] {
+				seen[key] = true
+				transfers = append(transfers, l)
+			}
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].BlockNumber != transfers[j].BlockNumber {
+			return transfers[i].BlockNumber < transfers[j].BlockNumber
+		}
+		return transfers[i].LogIndex < transfers[j].LogIndex
+	})
+	held := []string{}
+	for _, l := range transfers {
+		if len(l.Topics) != 4 {
+			continue
+		}
+		tokenId := strings.ToLower(l.Topics[3])
+		isHeld := false
+		for i, id := range held {
+			if id == tokenId {
+				isHeld = true
+				if !us.isOwnAddress(topicAddress(l.Topics[2])) {
+					held = append(held[:i], held[i+1:]...)
+				}
+				break
+			}
+		}
+		if !isHeld && us.isOwnAddress(topicAddress(l.Topics[2])) {
+			held = append(held, tokenId)
+		}
+	}
+
+	tokens := map[string]Token{strings.ToLower(TOKEN_WETH.Address): TOKEN_WETH}
+	positions := []V3Position{}
+	for _, id := range held {
+		tokenId, err := decodeUint(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		current, err := readV3Position(ctx, caller, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		if current.liquidity.Sign() == 0 {
+			continue
+		}
+		position := V3Position{
+			TokenId:   tokenId,
+			Fee:       current.fee,
+			TickLower: current.tickLower,
+			TickUpper: current.tickUpper,
+			Liquidity: current.liquidity,
+		}
+		for i, address := range []string{current.token0, current.token1} {
+			token, ok := tokens[address]
+			if !ok {
+				token, err = callToken(ctx, caller, address)
+				if err != nil {
+					return nil, err
+				}
+				tokens[address] = token
+			}
+			if i == 0 {
+				position.Token0 = token
+			} else {
+				position.Token1 = token
+			}
+		}
+		position, err = withV3Deposits(ctx, logSource, position, id)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// withV3Deposits sets the initial quantities from the IncreaseLiquidity
+// logs, scaled down to the liquidity still in the position
+func withV3Deposits(ctx context.Context, logSource LogSource, position V3Position, tokenIdTopic string) (V3Position, error) {
+	logs, err := logSource.GetLogs(ctx, LogQuery{
+		Address: UNISWAP_V3_POSITION_MANAGER_ADDRESS,
+		ToBlock: ETHERSCAN_LATEST_BLOCK,
+		Topics:  []string{TOPIC_V3_INCREASE_LIQUIDITY, tokenIdTopic},
+	})
+	if err != nil {
+		return position, err
+	}
+	liquidity := new(big.Int)
+	amount0 := new(big.Int)
+	amount1 := new(big.Int)
+	for i, l := range logs {
+		words, err := decodeWords(l.Data, 3)
+		if err != nil {
+			return position, err
+		}
+		liquidity.Add(liquidity, words[0])
+		amount0.Add(amount0, words[1])
+		amount1.Add(amount1, words[2])
+		if i == 0 || l.TimeStamp.Before(position.InitialDate) {
+			position.InitialDate = l.TimeStamp
+		}
+	}
+	remaining := big.NewRat(1, 1)
+	if liquidity.Sign() > 0 {
+		remaining.SetFrac(position.Liquidity, liquidity)
+	}
+	position.Token0InitialQuantity = scaleAmount(NewTokenAmount(amount0, position.Token0.Decimals), remaining)
+	position.Token1InitialQuantity = scaleAmount(NewTokenAmount(amount1, position.Token1.Decimals), remaining)
+	return position, nil
+}
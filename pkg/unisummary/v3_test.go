@@ -0,0 +1,131 @@
+package unisummary
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transactionsOnlySource implements no optional interface
+type transactionsOnlySource struct{}
+
+func (transactionsOnlySource) GetBalance(ctx context.Context, tokenAddress string, walletAddress string) (string, error) {
+	return "0", nil
+}
+
+func (transactionsOnlySource) GetSupply(ctx context.Context, tokenAddress string) (string, error) {
+	return "0", nil
+}
+
+func (transactionsOnlySource) GetNormalTransactions(ctx context.Context, walletAddress string) (EtherscanNormalTransactionsResponse, error) {
+	return EtherscanNormalTransactionsResponse{}, nil
+}
+
+func (transactionsOnlySource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	return EtherscanTokenTransactionsResponse{}, nil
+}
+
+func (transactionsOnlySource) GetInternalTransactions(ctx context.Context, walletAddress string) (EtherscanInternalTransactionsResponse, error) {
+	return EtherscanInternalTransactionsResponse{}, nil
+}
+
+func TestDoV3RequiresContractCalls(t *testing.T) {
+	us := UniswapSummaryRequest{
+		DataSource:  transactionsOnlySource{},
+		V3Positions: []V3Position{{TokenId: big.NewInt(1)}},
+	}
+	_, err := us.DoV3Context(context.Background())
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("DoV3Context error = %v, want ErrNotSupported", err)
+	}
+}
+
+func TestDoV3PositionErrors(t *testing.T) {
+	server := newJsonRpcStandIn(t, map[string]string{})
+	defer server.Close()
+	var reports []Progress
+	us := UniswapSummaryRequest{
+		DataSource:  NewJsonRpcDataSource(server.URL, nil),
+		V3Positions: []V3Position{{TokenId: big.NewInt(7)}},
+		Progress:    func(p Progress) { reports = append(reports, p) },
+	}
+	_, err := us.DoV3Context(context.Background())
+	if len(reports) != 1 || reports[0].Cache != (CacheStats{Misses: 1}) {
+		t.Errorf("progress reports = %+v, want one with a cache miss", reports)
+	}
+	var positionErrors V3PositionErrors
+	if !errors.As(err, &positionErrors) || len(positionErrors) != 1 {
+		t.Fatalf("DoV3Context error = %v, want V3PositionErrors", err)
+	}
+	if positionErrors[0].Position.TokenId.Int64() != 7 {
+		t.Errorf("failed position = %s, want 7", positionErrors[0].Position.TokenId)
+	}
+	var rpcErr *JsonRpcError
+	if !errors.As(positionErrors[0], &rpcErr) {
+		t.Errorf("position error = %v, want the JSON-RPC error", positionErrors[0])
+	}
+}
+
+func TestV3ReturnsWithoutBase(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name                        string
+		principal, fee, hodl        *big.Rat
+		initialDate                 time.Time
+		fees, divergence, days, apy float64
+	}{
+		{"no liquidity", new(big.Rat), big.NewRat(1, 1), big.NewRat(100, 1), now.AddDate(0, 0, -365), 0, -100, 365, -100},
+		{"no initial quantities", big.NewRat(100, 1), big.NewRat(10, 1), new(big.Rat), now.AddDate(0, 0, -365), 10, 0, 365, 10},
+		{"no initial date", big.NewRat(100, 1), big.NewRat(10, 1), big.NewRat(100, 1), time.Time{}, 10, 0, 0, 0},
+	}
+	for _, test := range tests {
+		fees, divergence, _, days, apy := v3Returns(test.principal, test.fee, test.hodl, test.initialDate, now)
+		if math.Abs(fees-test.fees) > 1e-9 || math.Abs(divergence-test.divergence) > 1e-9 || math.Abs(days-test.days) > 1e-9 || math.Abs(apy-test.apy) > 1e-9 {
+			t.Errorf("%s: v3Returns = fees %v, divergence %v, days %v, yearly %v", test.name, fees, divergence, days, apy)
+		}
+	}
+}
+
+func TestDoV3ReadsPositionTokens(t *testing.T) {
+	zero := leftPad("0")
+	bytes32 := func(symbol string) string {
+		return "0x" + hex.EncodeToString([]byte(symbol)) + strings.Repeat("0", 64-2*len(symbol))
+	}
+	tokenId := big.NewInt(7)
+	server := newJsonRpcStandIn(t, map[string]string{
+		UNISWAP_V3_POSITION_MANAGER_ADDRESS + encodeCall(SELECTOR_V3_POSITIONS, encodeUint(tokenId)): "0x" + zero + zero +
+			encodeAddress(testToken0) + encodeAddress(testToken1) + encodeUint(big.NewInt(3000)) + encodeInt(-60) + encodeInt(60) +
+			encodeUint(big.NewInt(1e18)) + zero + zero + zero + zero,
+		UNISWAP_V3_FACTORY_ADDRESS + encodeCall(SELECTOR_V3_GET_POOL, encodeAddress(testToken0), encodeAddress(testToken1), encodeUint(big.NewInt(3000))): "0x" + encodeAddress(testPair),
+		testPair + encodeCall(SELECTOR_V3_SLOT0):                 "0x" + encodeUint(new(big.Int).Lsh(big.NewInt(1), 96)) + encodeInt(0),
+		testPair + encodeCall(SELECTOR_V3_FEE_GROWTH_GLOBAL0):    "0x" + zero,
+		testPair + encodeCall(SELECTOR_V3_FEE_GROWTH_GLOBAL1):    "0x" + zero,
+		testPair + encodeCall(SELECTOR_V3_TICKS, encodeInt(-60)): "0x" + zero + zero + zero + zero,
+		testPair + encodeCall(SELECTOR_V3_TICKS, encodeInt(60)):  "0x" + zero + zero + zero + zero,
+		testToken0 + encodeCall(SELECTOR_DECIMALS):               "0x" + encodeUint(big.NewInt(18)),
+		testToken0 + encodeCall(SELECTOR_SYMBOL):                 bytes32("AAA"),
+		testToken1 + encodeCall(SELECTOR_DECIMALS):               "0x" + encodeUint(big.NewInt(6)),
+		testToken1 + encodeCall(SELECTOR_SYMBOL):                 bytes32("BBB"),
+	})
+	defer server.Close()
+	us := UniswapSummaryRequest{
+		DataSource:  NewJsonRpcDataSource(server.URL, nil),
+		V3Positions: []V3Position{{TokenId: tokenId}},
+	}
+	responses, err := us.DoV3Context(context.Background())
+	if err != nil || len(responses) != 1 {
+		t.Fatalf("DoV3Context = %d responses, %v", len(responses), err)
+	}
+	position := responses[0].Position
+	if position.Token0 != (Token{"AAA", testToken0, 18}) || position.Token1 != (Token{"BBB", testToken1, 6}) {
+		t.Errorf("tokens = %+v, %+v, want AAA and BBB", position.Token0, position.Token1)
+	}
+	if responses[0].Token0Quantity.Decimals != 18 || responses[0].Token1Quantity.Decimals != 6 {
+		t.Errorf("quantity decimals = %d, %d, want 18, 6", responses[0].Token0Quantity.Decimals, responses[0].Token1Quantity.Decimals)
+	}
+}
@@ -0,0 +1,144 @@
+package unisummary
+
+import (
+	"context"
+	"sort"
+	"strconv"
+)
+
+// wallets returns the user wallet followed by the other wallets of the
+// same owner
+func (us UniswapSummaryRequest) wallets() []string {
+	wallets := []string{us.UserAddress}
+	for _, w := range us.UserAddresses {
+		isListed := false
+		for _, listed := range wallets {
+			isListed = isListed || icaseCompare(listed, w)
+		}
+		if !isListed {
+			wallets = append(wallets, w)
+		}
+	}
+	return wallets
+}
+
+func (us UniswapSummaryRequest) isOwnAddress(address string) bool {
+	if icaseCompare(us.UserAddress, address) {
+		return true
+	}
+	for _, w := range us.UserAddresses {
+		if icaseCompare(w, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalTransfer tells whether tokens moved between two wallets of
+// the owner, which changes neither the cost basis nor the position date
+func (us UniswapSummaryRequest) isInternalTransfer(from, to string) bool {
+	return us.isOwnAddress(from) && us.isOwnAddress(to)
+}
+
+// The history of every wallet is merged in block order. A transfer between
+// two of the wallets shows up in both histories and is kept once
+
+// walletRows drops the rows already found in an earlier wallet history.
+// Identical rows within one history are distinct transfers and are kept
+type walletRows struct {
+	earlier map[string]int
+	current map[string]int
+}
+
+func newWalletRows() *walletRows {
+	return &walletRows{earlier: map[string]int{}, current: map[string]int{}}
+}
+
+func (w *walletRows) keep(key string) bool {
+	w.current[key]++
+	return w.current[key] > w.earlier[key]
+}
+
+func (w *walletRows) nextWallet() {
+	for key, n := range w.current {
+		if n > w.earlier[key] {
+			w.earlier[key] = n
+		}
+	}
+	w.current = map[string]int{}
+}
+
+func (us UniswapSummaryRequest) fetchNormalTransactions(ctx context.Context) (EtherscanNormalTransactionsResponse, error) {
+	var merged EtherscanNormalTransactionsResponse
+	rows := newWalletRows()
+	for _, w := range us.wallets() {
+		r, err := us.DataSource.GetNormalTransactions(ctx, w)
+		if err != nil {
+			return merged, err
+		}
+		merged.Status, merged.Message = r.Status, r.Message
+		for _, t := range r.Result {
+			if rows.keep(t.Hash) {
+				merged.Result = append(merged.Result, t)
+			}
+		}
+		rows.nextWallet()
+	}
+	sort.SliceStable(merged.Result, func(i, j int) bool {
+		return blockBefore(merged.Result[i].BlockNumber, merged.Result[j].BlockNumber)
+	})
+	return merged, nil
+}
+
+func (us UniswapSummaryRequest) fetchTokenTransactions(ctx context.Context) (EtherscanTokenTransactionsResponse, error) {
+	var merged EtherscanTokenTransactionsResponse
+	rows := newWalletRows()
+	for _, w := range us.wallets() {
+		r, err := us.DataSource.GetTokenTransactions(ctx, w)
+		if err != nil {
+			return merged, err
+		}
+		merged.Status, merged.Message = r.Status, r.Message
+		for _, t := range r.Result {
+			key := t.Hash + t.ContractAddress + t.From + t.To + t.Value
+			if rows.keep(key) {
+				merged.Result = append(merged.Result, t)
+			}
+		}
+		rows.nextWallet()
+	}
+	sort.SliceStable(merged.Result, func(i, j int) bool {
+		return blockBefore(merged.Result[i].BlockNumber, merged.Result[j].BlockNumber)
+	})
+	return merged, nil
+}
+
+func (us UniswapSummaryRequest) fetchInternalTransactions(ctx context.Context) (EtherscanInternalTransactionsResponse, error) {
+	var merged EtherscanInternalTransactionsResponse
+	rows := newWalletRows()
+	for _, w := range us.wallets() {
+		r, err := us.DataSource.GetInternalTransactions(ctx, w)
+		if err != nil {
+			return merged, err
+		}
+		merged.Status, merged.Message = r.Status, r.Message
+		for _, t := range r.Result {
+			key := t.Hash + t.TraceId + t.From + t.To + t.Value
+			if rows.keep(key) {
+				merged.Result = append(merged.Result, t)
+			}
+		}
+		rows.nextWallet()
+	}
+	sort.SliceStable(merged.Result, func(i, j int) bool {
+		return blockBefore(merged.Result[i].BlockNumber, merged.Result[j].BlockNumber)
+	})
+	return merged, nil
+}
+
+// Malformed block numbers sort first and are reported when parsed later
+func blockBefore(a, b string) bool {
+	i, _ := strconv.ParseInt(a, 10, 64)
+	j, _ := strconv.ParseInt(b, 10, 64)
+	return i < j
+}
@@ -0,0 +1,47 @@
+package unisummary
+
+import (
+	"context"
+	"testing"
+)
+
+// tokenHistorySource returns a fixed token transfer history per wallet
+type tokenHistorySource struct {
+	transactionsOnlySource
+	histories map[string][]EtherscanTokenTransaction
+}
+
+func (s tokenHistorySource) GetTokenTransactions(ctx context.Context, walletAddress string) (EtherscanTokenTransactionsResponse, error) {
+	return EtherscanTokenTransactionsResponse{Result: s.histories[walletAddress]}, nil
+}
+
+func TestFetchTokenTransactionsAcrossWallets(t *testing.T) {
+	const other = "0x0000000000000000000000000000000000000111"
+	transfer := func(hash string, from string, to string) EtherscanTokenTransaction {
+		return EtherscanTokenTransaction{Hash: hash, BlockNumber: "1", From: from, To: to, ContractAddress: testPair, Value: "5"}
+	}
+	// A batch paying the same amount twice to a wallet, and a transfer
+	// between the two wallets of the owner
+	batch := transfer("0x01", testPair, testWallet)
+	internal := transfer("0x02", testWallet, other)
+	us := UniswapSummaryRequest{
+		UserAddress:   testWallet,
+		UserAddresses: []string{other},
+		DataSource: tokenHistorySource{histories: map[string][]EtherscanTokenTransaction{
+			testWallet: {batch, batch, internal},
+			other:      {internal},
+		}},
+	}
+
+	merged, err := us.fetchTokenTransactions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, tt := range merged.Result {
+		counts[tt.Hash]++
+	}
+	if counts["0x01"] != 2 || counts["0x02"] != 1 {
+		t.Errorf("rows per hash = %v, want 2 batch transfers and 1 internal transfer", counts)
+	}
+}
@@ -0,0 +1,77 @@
+package unisummary
+
+import (
+	"context"
+	"sync"
+)
+
+// Positions summarized at the same time by Do(). Each one makes a few
+// requests of its own, which the rate limiter then spaces out
+const DEFAULT_CONCURRENCY = 4
+
+// Progress is reported after each position is summarized, in the order
+// they finish
+type Progress struct {
+	Done  int
+	Total int
+	// Index of the position in the request
+	Index int
+	Err   error
+	// Lookups served so far by the cache of the run
+	Cache CacheStats
+}
+
+// withCacheStats adds the counters of the run cache to each report
+func withCacheStats(progress func(Progress), cache CachedDataSource) func(Progress) {
+	if progress == nil {
+		return nil
+	}
+	return func(p Progress) {
+		p.Cache = cache.Stats()
+		progress(p)
+	}
+}
+
+// runPool calls work for each index from 0 to total-1 on at most
+// concurrency workers. Results are kept by index, so their order does not
+// depend on the scheduling. Indexes not started before ctx is cancelled
+// get its error
+func runPool(ctx context.Context, total int, concurrency int, progress func(Progress), work func(index int) error) []error {
+	if concurrency <= 0 {
+		concurrency = DEFAULT_CONCURRENCY
+	}
+	if concurrency > total {
+		concurrency = total
+	}
+	errs := make([]error, total)
+	indexes := make(chan int)
+	var mutex sync.Mutex
+	done := 0
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				err := ctx.Err()
+				if err == nil {
+					err = work(index)
+				}
+				errs[index] = err
+				// Callbacks are serialized, so they need no locking
+				mutex.Lock()
+				done++
+				if progress != nil {
+					progress(Progress{Done: done, Total: total, Index: index, Err: err})
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
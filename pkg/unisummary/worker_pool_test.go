@@ -0,0 +1,79 @@
+package unisummary
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunPool(t *testing.T) {
+	const total = 20
+	const concurrency = 3
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	results := make([]int, total)
+	var reports []Progress
+	errs := runPool(context.Background(), total, concurrency, func(p Progress) {
+		reports = append(reports, p)
+	}, func(index int) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		// Later indexes finish first
+		time.Sleep(time.Duration(total-index) * time.Millisecond)
+		results[index] = index * index
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		if index%5 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if maxRunning > concurrency || maxRunning < 2 {
+		t.Errorf("%d workers at once, want at most %d", maxRunning, concurrency)
+	}
+	for i := 0; i < total; i++ {
+		if results[i] != i*i || (errs[i] != nil) != (i%5 == 0) {
+			t.Errorf("index %d: result %d, error %v", i, results[i], errs[i])
+		}
+	}
+	if len(reports) != total || reports[total-1].Done != total {
+		t.Fatalf("%d progress reports, the last %+v, want %d ending with Done == Total", len(reports), reports[len(reports)-1], total)
+	}
+	seen := map[int]bool{}
+	for i, p := range reports {
+		if p.Done != i+1 || p.Total != total || seen[p.Index] || (p.Err != nil) != (p.Index%5 == 0) {
+			t.Errorf("progress report %d = %+v", i, p)
+		}
+		seen[p.Index] = true
+	}
+}
+
+func TestRunPoolCancel(t *testing.T) {
+	const total = 10
+	ctx, cancel := context.WithCancel(context.Background())
+	var started []int
+	// A single worker takes the indexes in order
+	errs := runPool(ctx, total, 1, nil, func(index int) error {
+		started = append(started, index)
+		if index == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if len(started) != 3 {
+		t.Errorf("started indexes %v, want 0 to 2", started)
+	}
+	for i := 0; i < total; i++ {
+		if want := i > 2; errors.Is(errs[i], context.Canceled) != want {
+			t.Errorf("index %d error = %v, want the context error %v", i, errs[i], want)
+		}
+	}
+}